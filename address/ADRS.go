@@ -151,3 +151,9 @@ func (adrs *ADRS) GetTreeAddress() int {
 	treeAddressUint64 := binary.BigEndian.Uint64(treeAddressBytes)
 	return int(treeAddressUint64)
 }
+
+func (adrs *ADRS) GetLayerAddress() int {
+	layerAddressBytes := adrs.LayerAddress[:]
+	layerAddressUint32 := binary.BigEndian.Uint32(layerAddressBytes)
+	return int(layerAddressUint32)
+}
@@ -0,0 +1,739 @@
+package attack
+
+import (
+	"bytes"
+	"encoding/hex"
+	"io/ioutil"
+	"math"
+	mathrand "math/rand"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/kasperdi/SPHINCSPLUS-golang/hypertree"
+	"github.com/kasperdi/SPHINCSPLUS-golang/parameters"
+	"github.com/kasperdi/SPHINCSPLUS-golang/sphincs"
+	"github.com/kasperdi/SPHINCSPLUS-golang/util"
+	"github.com/kasperdi/SPHINCSPLUS-golang/wots"
+)
+
+func TestChainStateUpdate(t *testing.T) {
+	params := parameters.MakeSphincsPlusToy(false)
+	rng := util.NewDRBG([]byte("chain state"))
+	sk, pk := sphincs.Spx_keygen_rng(params, rng)
+	message := rng.Bytes(params.N)
+	signature := sphincs.Spx_sign_rng(params, message, sk, rng)
+
+	state, err := NewChainState(params, pk, message, signature, params.D-1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state.Update(params, pk.PKseed, state.Signature) {
+		t.Errorf("The valid signature shouldn't shorten any chain")
+	}
+	if !state.Signable(params, MsgToBaseW(params, state.Message)) {
+		t.Errorf("Expected the valid message to be signable")
+	}
+	forged := state.Forge(params, pk.PKseed, MsgToBaseW(params, state.Message))
+	if string(forged) != string(state.Signature) {
+		t.Errorf("Forging the valid message should give the valid WOTS signature")
+	}
+
+	if _, err := NewChainState(params, pk, rng.Bytes(params.N), signature, params.D-1); err != ErrInvalidSignature {
+		t.Errorf("Expected ErrInvalidSignature for a signature of a different message")
+	}
+}
+
+// newFaultedCollector attacks the top layer of a toy key pair from seed, collecting a valid signature and faults
+// faulty signatures of one message, each of which must be faulted in the layer below
+func newFaultedCollector(t *testing.T, seed []byte, faults int) (*Collector, *testOracle) {
+	t.Helper()
+	params := parameters.MakeSphincsPlusToy(false)
+	oracle := newTestOracle(params, seed)
+	collector := NewCollector(params, oracle.pk, oracle.rng.Bytes(params.N), []int{params.D - 1})
+	signature, _ := oracle.Sign(collector.Message)
+	if added, err := collector.AddValid(signature); err != nil || added != 1 {
+		t.Fatalf("Expected the valid signature to add a single key")
+	}
+	for i := 0; i < faults; i++ {
+		signature, _ := oracle.SignFaulty(collector.Message)
+		requireFaultedBelowTop(t, collector.AddFaulty(signature))
+	}
+	return collector, oracle
+}
+
+// requireFaultedBelowTop fails the test unless a faulty signature went through a known top layer key and only the layer
+// below it was identified as faulted
+func requireFaultedBelowTop(t *testing.T, result *FaultyResult) {
+	t.Helper()
+	if len(result.Unknown) > 0 || len(result.Derived) > 0 {
+		t.Fatalf("Expected the faulty signature to use a known key")
+	}
+	if layer := parameters.MakeSphincsPlusToy(false).D - 2; len(result.FaultedLayers) != 1 || result.FaultedLayers[0] != layer {
+		t.Fatalf("Expected layer %d to be identified as faulted, got %v", layer, result.FaultedLayers)
+	}
+}
+
+// requireForgery fails the test unless collector forges a signature of a random message which verifies under pk
+func requireForgery(t *testing.T, collector *Collector, pk *sphincs.SPHINCS_PK, rng *util.DRBG) {
+	t.Helper()
+	forgedMessage := rng.Bytes(collector.Params.N)
+	forgedSignature, _, err := NewForger(collector, rng).Forge(forgedMessage, 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !sphincs.Spx_verify(collector.Params, forgedMessage, forgedSignature, pk) {
+		t.Errorf("Forged signature doesn't verify")
+	}
+}
+
+func TestCollectorAndForger(t *testing.T) {
+	collector, oracle := newFaultedCollector(t, []byte("forger"), 300)
+	if keys := NumberOfWOTSKeys(collector.Params, collector.Params.D-1); collector.Remaining() != keys-1 {
+		t.Errorf("Expected %d remaining keys", keys-1)
+	}
+	requireForgery(t, collector, oracle.pk, oracle.rng)
+}
+
+func TestPartialSignatureLargeSubtree(t *testing.T) {
+	// 2^8 WOTS keys in the top layer, as in the s parameter sets
+	params := parameters.MakeSphincsPlus(16, 16, 16, 2, 14, 6, "SHA256-robust", true)
+	rng := util.NewDRBG([]byte("large subtree"))
+	sk, pk := sphincs.Spx_keygen_rng(params, rng)
+	message := rng.Bytes(params.N)
+
+	collector := NewCollector(params, pk, message, []int{params.D - 1})
+	if _, err := collector.AddValid(sphincs.Spx_sign_rng(params, message, sk, rng)); err != nil {
+		t.Fatal(err)
+	}
+	forger := NewForger(collector, rng)
+	forgedMessage := rng.Bytes(params.N)
+	for i := 0; i < 3; i++ {
+		partialFSig := forger.PartialSignature(forgedMessage)
+		if _, known := collector.States[KeyFromMsg(params, partialFSig.R, pk, forgedMessage, params.D-1)]; !known {
+			t.Fatalf("Partial signature doesn't use the known key")
+		}
+		if attempt := forger.Check(forgedMessage, partialFSig); attempt.MessageBlocks == nil {
+			t.Errorf("Expected the known key to be checked")
+		}
+	}
+}
+
+func TestCollectorAddDerived(t *testing.T) {
+	params := parameters.MakeSphincsPlusToy(false)
+	oracle := newTestOracle(params, []byte("derived"))
+
+	// no valid signatures, every key is derived from the faulty signatures
+	collector := NewCollector(params, oracle.pk, oracle.rng.Bytes(params.N), []int{params.D - 1})
+	signature, _ := oracle.SignFaulty(collector.Message)
+	if result := collector.AddDerived(signature); len(result.Derived) != 1 || len(collector.States) != 1 {
+		t.Fatalf("Expected the first faulty signature to derive the key")
+	}
+	for i := 0; i < 300; i++ {
+		signature, _ := oracle.SignFaulty(collector.Message)
+		requireFaultedBelowTop(t, collector.AddDerived(signature))
+	}
+	requireForgery(t, collector, oracle.pk, oracle.rng)
+}
+
+func TestChainWalker(t *testing.T) {
+	params := parameters.MakeSphincsPlusToy(false)
+	oracle := newTestOracle(params, []byte("walker"))
+	pk := oracle.pk
+	message := oracle.rng.Bytes(params.N)
+	signature, _ := oracle.Sign(message)
+	state, err := NewChainState(params, pk, message, signature, params.D-1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// faulty signatures through the same key, compared with the positions found by chaining from scratch
+	sigs := make([][]byte, 0)
+	for i := 0; i < 20; i++ {
+		signature, _ := oracle.SignFaulty(message)
+		sigs = append(sigs, signature.SIG_HT.GetXMSSSignature(params.D-1).WotsSignature)
+	}
+	// a block knocked off its hash chain
+	offChain := append([]byte(nil), sigs[0]...)
+	offChain[0] ^= 1
+	sigs = append(sigs, offChain)
+
+	walker := NewChainWalker(params, pk.PKseed, state.Key, state.PublicKey)
+	for i, positions := range walker.BatchPositions(sigs) {
+		expected := make([]int, params.Len)
+		for block := 0; block < params.Len; block++ {
+			expected[block] = -1
+			for c := 0; c < params.W; c++ {
+				adrs := state.Key.Address()
+				adrs.SetChainAddress(block)
+				hashed := wots.Chain(params, sigs[i][block*params.N:(block+1)*params.N], params.W-1-c, c, pk.PKseed, adrs)
+				if bytes.Equal(hashed, state.PublicKey[block*params.N:(block+1)*params.N]) {
+					expected[block] = params.W - 1 - c
+					break
+				}
+			}
+		}
+		if !reflect.DeepEqual(positions, expected) {
+			t.Fatalf("Signature %d: expected positions %v, got %v", i, expected, positions)
+		}
+	}
+	if positions := walker.Positions(offChain); positions[0] != -1 {
+		t.Errorf("Expected the corrupted block to be off its chain")
+	}
+
+	if !state.UpdateBatch(params, pk.PKseed, sigs) {
+		t.Errorf("Expected faulty signatures to shorten a chain")
+	}
+}
+
+// faulty WOTS signatures of the top layer key, for comparing the chain search with the walker
+func benchmarkSignatures(b *testing.B) (*parameters.Parameters, *ChainState, []byte, [][]byte) {
+	params := parameters.MakeSphincsPlusSHA256128fRobust(false)
+	oracle := newTestOracle(params, []byte("walker benchmark"))
+	message := oracle.rng.Bytes(params.N)
+	signature, _ := oracle.Sign(message)
+	state, err := NewChainState(params, oracle.pk, message, signature, params.D-1)
+	if err != nil {
+		b.Fatal(err)
+	}
+	sigs := make([][]byte, 100)
+	for i := range sigs {
+		signature, _ := oracle.SignFaulty(message)
+		sigs[i] = signature.SIG_HT.GetXMSSSignature(params.D - 1).WotsSignature
+	}
+	return params, state, oracle.pk.PKseed, sigs
+}
+
+func BenchmarkChainPositions(b *testing.B) {
+	params, state, PKseed, sigs := benchmarkSignatures(b)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, sig := range sigs {
+			ChainPositions(params, sig, state.PublicKey, PKseed, state.Key)
+		}
+	}
+}
+
+func BenchmarkChainWalker(b *testing.B) {
+	params, state, PKseed, sigs := benchmarkSignatures(b)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		NewChainWalker(params, PKseed, state.Key, state.PublicKey).BatchPositions(sigs)
+	}
+}
+
+// knocks blocks of every signature off their chains, the worst case for the walker
+func BenchmarkChainWalkerOffChain(b *testing.B) {
+	params, state, PKseed, sigs := benchmarkSignatures(b)
+	offChain := make([][]byte, len(sigs))
+	for i, sig := range sigs {
+		offChain[i] = append([]byte(nil), sig...)
+		for block := i % 4; block < params.Len; block += 4 {
+			offChain[i][block*params.N] ^= 0x01
+		}
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		NewChainWalker(params, PKseed, state.Key, state.PublicKey).BatchPositions(offChain)
+	}
+}
+
+func TestStateRoundTrip(t *testing.T) {
+	collector, oracle := newFaultedCollector(t, []byte("state"), 300)
+	params := collector.Params
+
+	state, err := NewState(collector, "toy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	filename := filepath.Join(t.TempDir(), "state.json")
+	if err := WriteState(filename, state); err != nil {
+		t.Fatal(err)
+	}
+	read, err := ReadState(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := read.Collector(params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(loaded.Message, collector.Message) || !reflect.DeepEqual(loaded.PK, collector.PK) {
+		t.Errorf("Loaded message or public key differs")
+	}
+	for key, chainState := range collector.States {
+		loadedState := loaded.States[key]
+		if loadedState == nil || !reflect.DeepEqual(loadedState.HashCount, chainState.HashCount) ||
+			!bytes.Equal(loadedState.ShortestHashChains, chainState.ShortestHashChains) || !bytes.Equal(loadedState.PublicKey, chainState.PublicKey) {
+			t.Fatalf("Loaded chain state of %v differs", key)
+		}
+	}
+
+	// the loaded state forges without the original valid signature
+	requireForgery(t, loaded, oracle.pk, oracle.rng)
+
+	state.Version = StateVersion + 1
+	if err := WriteState(filename, state); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadState(filename); err != ErrStateVersion {
+		t.Errorf("Expected ErrStateVersion, got %v", err)
+	}
+}
+
+// testOracle signs in process, faulting every faulty signature with faultModel
+type testOracle struct {
+	params      *parameters.Parameters
+	sk          *sphincs.SPHINCS_SK
+	pk          *sphincs.SPHINCS_PK
+	faultModel  hypertree.FaultModel
+	rng         *util.DRBG
+	validSigns  int
+	faultySigns int
+}
+
+func newTestOracle(params *parameters.Parameters, seed []byte) *testOracle {
+	rng := util.NewDRBG(seed)
+	sk, pk := sphincs.Spx_keygen_rng(params, rng)
+	faultModel := &hypertree.BitFlipFault{Layer: params.D - 2, Magnitude: hypertree.FixedMagnitude(8), Rand: mathrand.New(rng)}
+	return &testOracle{params: params, sk: sk, pk: pk, faultModel: faultModel, rng: rng}
+}
+
+func (o *testOracle) PublicKey() *sphincs.SPHINCS_PK {
+	return o.pk
+}
+
+func (o *testOracle) Sign(message []byte) (*sphincs.SPHINCS_SIG, error) {
+	o.validSigns += 1
+	return sphincs.Spx_sign_rng(o.params, message, o.sk, o.rng), nil
+}
+
+func (o *testOracle) SignFaulty(message []byte) (*sphincs.SPHINCS_SIG, error) {
+	o.faultySigns += 1
+	return sphincs.Spx_sign_fault(o.params, message, o.sk, o.faultModel, o.rng), nil
+}
+
+func (o *testOracle) Queries() (int, int) {
+	return o.validSigns, o.faultySigns
+}
+
+func (o *testOracle) Close() error {
+	return nil
+}
+
+func TestRemoteOracle(t *testing.T) {
+	params := parameters.MakeSphincsPlusToy(false)
+	oracle := newTestOracle(params, []byte("remote"))
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	served := make(chan error)
+	go func() {
+		served <- ServeOracle(listener, oracle, "toy")
+	}()
+
+	if _, err := DialOracle("tcp", listener.Addr().String(), params, "other"); err == nil {
+		t.Errorf("Expected an oracle of another parameter set to be rejected")
+	}
+	remote, err := DialOracle("tcp", listener.Addr().String(), params, "toy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(remote.PublicKey(), oracle.pk) {
+		t.Errorf("Remote public key differs")
+	}
+
+	message := []byte("remote oracle test message")
+	signature, err := remote.Sign(message)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !sphincs.Spx_verify(params, message, signature, remote.PublicKey()) {
+		t.Errorf("Remote signature doesn't verify")
+	}
+	collector := NewCollector(params, remote.PublicKey(), message, []int{params.D - 1})
+	if _, err := collector.AddValid(signature); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		faulty, err := remote.SignFaulty(message)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result := collector.AddFaulty(faulty); len(result.FaultedLayers) != 1 {
+			t.Errorf("Expected the remote faulty signature to be faulted in layer %d, got %v", params.D-2, result.FaultedLayers)
+		}
+	}
+	if validSigns, faultySigns := remote.Queries(); validSigns != 1 || faultySigns != 3 {
+		t.Errorf("Expected 1 valid and 3 faulty queries, got %d and %d", validSigns, faultySigns)
+	}
+
+	if err := remote.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := remote.Sign(message); err != ErrOracleClosed {
+		t.Errorf("Expected ErrOracleClosed, got %v", err)
+	}
+	if err := listener.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-served; err != nil {
+		t.Errorf("Expected the oracle to stop serving without error, got %v", err)
+	}
+}
+
+func TestReadSignatures(t *testing.T) {
+	params := parameters.MakeSphincsPlusToy(false)
+	oracle := newTestOracle(params, []byte("captures"))
+	message := []byte("captured message")
+	serialized := make([][]byte, 3)
+	for i := range serialized {
+		signature, _ := oracle.SignFaulty(message)
+		serialized[i], _ = signature.SerializeSignature()
+	}
+	pk, _ := oracle.pk.SerializePK()
+
+	// two signatures as hex on one line and one raw, in a directory
+	dir := t.TempDir()
+	hexCaptures := hex.EncodeToString(serialized[0]) + hex.EncodeToString(serialized[1]) + "\n"
+	if err := ioutil.WriteFile(filepath.Join(dir, "a.hex"), []byte(hexCaptures), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "b.bin"), serialized[2], 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "pk.hex"), []byte(hex.EncodeToString(pk)), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	signatures, err := ReadSignatures(params, filepath.Join(dir, "a.hex"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(signatures) != 2 {
+		t.Fatalf("Expected 2 signatures, got %d", len(signatures))
+	}
+	readPK, err := ReadPublicKey(params, filepath.Join(dir, "pk.hex"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(readPK, oracle.pk) {
+		t.Errorf("Read public key differs")
+	}
+	if err := os.Remove(filepath.Join(dir, "pk.hex")); err != nil {
+		t.Fatal(err)
+	}
+	signatures, err = ReadSignatures(params, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(signatures) != 3 {
+		t.Fatalf("Expected 3 signatures, got %d", len(signatures))
+	}
+	for i, signature := range signatures {
+		if b, _ := signature.SerializeSignature(); !bytes.Equal(b, serialized[i]) {
+			t.Errorf("Signature %d differs from the captured one", i)
+		}
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(dir, "c.bin"), serialized[2][1:], 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadSignatures(params, dir); err == nil {
+		t.Errorf("Expected a truncated capture to be rejected")
+	}
+}
+
+func TestReadMessages(t *testing.T) {
+	params := parameters.MakeSphincsPlusToy(false)
+	oracle := newTestOracle(params, []byte("captured messages"))
+	messages := NewDistinctMessageSource([]byte("captured message"), []byte("captured messages"))
+	signed := make([][]byte, 4)
+	lines := ""
+	for i := range signed {
+		signed[i] = messages.Next()
+		lines += hex.EncodeToString(signed[i]) + "\n"
+	}
+	filename := filepath.Join(t.TempDir(), "messages.hex")
+	if err := ioutil.WriteFile(filename, []byte(lines+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	read, err := ReadMessages(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(read, signed) {
+		t.Fatalf("Expected messages %x, got %x", signed, read)
+	}
+	for i, message := range read {
+		signature, _ := oracle.Sign(message)
+		if !sphincs.Spx_verify(params, message, signature, oracle.pk) {
+			t.Errorf("Signature %d doesn't verify with its read message", i)
+		}
+	}
+
+	if err := ioutil.WriteFile(filename, []byte("0102\nxyz\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadMessages(filename); err == nil {
+		t.Errorf("Expected a message which isn't hex to be rejected")
+	}
+}
+
+func TestTranscriptReplay(t *testing.T) {
+	params := parameters.MakeSphincsPlusToy(false)
+	filename := filepath.Join(t.TempDir(), "transcript.jsonl")
+	message := []byte("recorded message")
+
+	// two recording sessions of the same key pair append to one transcript
+	oracle := newTestOracle(params, []byte("transcript"))
+	recorded := make([][]byte, 0)
+	for session := 0; session < 2; session++ {
+		recorder, err := NewRecordingOracle(oracle, filename, "toy")
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < 2; i++ {
+			signature, err := recorder.SignFaulty(message)
+			if err != nil {
+				t.Fatal(err)
+			}
+			serialized, _ := signature.SerializeSignature()
+			recorded = append(recorded, serialized)
+		}
+		if _, err := recorder.Sign(message); err != nil {
+			t.Fatal(err)
+		}
+		if err := recorder.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	replay, err := NewReplayOracle(params, filename, "toy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(replay.PublicKey(), oracle.pk) {
+		t.Errorf("Replayed public key differs")
+	}
+	if _, err := replay.SignFaulty([]byte("another message")); err == nil {
+		t.Errorf("Expected a query of another message to fail")
+	}
+	for i, serialized := range recorded {
+		signature, err := replay.SignFaulty(message)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if b, _ := signature.SerializeSignature(); !bytes.Equal(b, serialized) {
+			t.Errorf("Replayed faulty signature %d differs", i)
+		}
+	}
+	if _, err := replay.SignFaulty(message); err != ErrTranscriptEnd {
+		t.Errorf("Expected ErrTranscriptEnd, got %v", err)
+	}
+	signature, err := replay.Sign(message)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !sphincs.Spx_verify(params, message, signature, replay.PublicKey()) {
+		t.Errorf("Replayed valid signature doesn't verify")
+	}
+	if validSigns, faultySigns := replay.Queries(); validSigns != 1 || faultySigns != 4 {
+		t.Errorf("Expected 1 valid and 4 faulty queries, got %d and %d", validSigns, faultySigns)
+	}
+
+	if _, err := NewReplayOracle(params, filename, "other"); err == nil {
+		t.Errorf("Expected a transcript of another parameter set to be rejected")
+	}
+	recorder, err := NewRecordingOracle(newTestOracle(params, []byte("another transcript")), filename, "toy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := recorder.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewReplayOracle(params, filename, "toy"); err == nil {
+		t.Errorf("Expected a transcript of two key pairs to be rejected")
+	}
+}
+
+// collectDistinct runs the attack with distinct messages drawn from seed against oracle, returning the shortest hash
+// chains found once faults faulty signatures were processed or the oracle had no more
+func collectDistinct(t *testing.T, oracle SigningOracle, seed []byte, faults int) map[WOTSKey][]int {
+	params := parameters.MakeSphincsPlusToy(false)
+	messages := NewDistinctMessageSource([]byte("attacked message"), seed)
+	collector := NewCollector(params, oracle.PublicKey(), []byte("attacked message"), []int{params.D - 1})
+	for collector.Remaining() > 0 {
+		message := messages.Next()
+		signature, err := oracle.Sign(message)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := collector.AddValidMessage(message, signature); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := 0; i < faults; i++ {
+		message := messages.Next()
+		signature, err := oracle.SignFaulty(message)
+		if err == ErrTranscriptEnd {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		collector.AddFaultyMessage(message, signature)
+	}
+	hashCounts := make(map[WOTSKey][]int)
+	for key, state := range collector.States {
+		hashCounts[key] = state.HashCount
+	}
+	return hashCounts
+}
+
+func TestTranscriptReplayDistinct(t *testing.T) {
+	params := parameters.MakeSphincsPlusToy(false)
+	filename := filepath.Join(t.TempDir(), "transcript.jsonl")
+	recorder, err := NewRecordingOracle(newTestOracle(params, []byte("transcript")), filename, "toy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	recorded := collectDistinct(t, recorder, []byte{0x01, 0x02}, 40)
+	if err := recorder.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the distinct messages only depend on the seed, so the replay queries exactly the recorded messages
+	replay, err := NewReplayOracle(params, filename, "toy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	replayed := collectDistinct(t, replay, []byte{0x01, 0x02}, 1000)
+	if _, faultySigns := replay.Queries(); faultySigns != 40 {
+		t.Errorf("Expected 40 faulty signatures replayed, got %d", faultySigns)
+	}
+	if !reflect.DeepEqual(recorded, replayed) {
+		t.Errorf("Replayed attack found other shortest hash chains")
+	}
+}
+
+func TestCollectorDistinctMessages(t *testing.T) {
+	// deterministic signing, so only distinct messages spread the signatures over the keys of the target layer
+	params := parameters.MakeSphincsPlusToy(false)
+	oracle := newTestOracle(params, []byte("distinct messages"))
+	rng := oracle.rng
+
+	collector := NewCollector(params, oracle.pk, rng.Bytes(params.N), []int{params.D - 1})
+	for collector.Remaining() > 0 {
+		message := rng.Bytes(params.N)
+		signature, _ := oracle.Sign(message)
+		if _, err := collector.AddValidMessage(message, signature); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := 0; i < 300; i++ {
+		message := rng.Bytes(params.N)
+		signature, _ := oracle.SignFaulty(message)
+		requireFaultedBelowTop(t, collector.AddFaultyMessage(message, signature))
+	}
+	requireForgery(t, collector, oracle.pk, rng)
+}
+
+func TestCollectorMultiLayer(t *testing.T) {
+	params := parameters.MakeSphincsPlusToy(false)
+	rng := util.NewDRBG([]byte("multi layer"))
+	sk, pk := sphincs.Spx_keygen_rng(params, rng)
+	message := rng.Bytes(params.N)
+	collector := NewCollector(params, pk, message, []int{0, 1, 2})
+	if _, err := collector.AddValid(sphincs.Spx_sign_rng(params, message, sk, rng)); err != nil {
+		t.Fatal(err)
+	}
+
+	faultRand := mathrand.New(rng)
+	// a layer 0 fault changes the root signed by layer 1, and a FORS index fault the message signed by layer 0
+	multi := &sphincs.MultiFault{MultiFault: &hypertree.MultiFault{Faults: []hypertree.FaultModel{
+		&hypertree.BitFlipFault{MaxBits: 64, Layer: 0, Rand: faultRand},
+	}}, Fors: &sphincs.ForsFault{Target: sphincs.IndicesTarget, Bits: 1, Rand: faultRand}}
+	for f := 0; f < 20; f++ {
+		signature, report := sphincs.Spx_sign_fault_report(params, message, sk, multi, rng)
+		result := collector.AddFaulty(signature)
+		for j := 0; j < params.D; j++ {
+			faulted := report.Layer(j) != nil && report.Layer(j).RootChanged
+			if faulted != result.Faulted(j) {
+				t.Fatalf("layer %d faulted %t but detected %t", j, faulted, result.Faulted(j))
+			}
+		}
+		if forsFaulted := len(report.ForsTrees) > 0; result.ForsChanged != forsFaulted {
+			t.Fatalf("FORS faulted %t but detected %t", forsFaulted, result.ForsChanged)
+		}
+	}
+}
+
+func TestForsLeaves(t *testing.T) {
+	params := parameters.MakeSphincsPlusToy(false)
+	rng := util.NewDRBG([]byte("FORS leaves"))
+	sk, pk := sphincs.Spx_keygen_rng(params, rng)
+	message := rng.Bytes(params.N)
+	leaves := NewForsLeaves(params, pk, message, sphincs.Spx_sign_rng(params, message, sk, rng))
+	if leaves.SignableFraction() != math.Pow(1/float64(params.T), float64(params.K)) {
+		t.Fatal("only the leaves of the valid signature should be known")
+	}
+	if md, _ := leaves.Forge(); md != nil {
+		t.Fatal("forged without any leaked leaves")
+	}
+
+	faultModel := &sphincs.ForsFault{Target: sphincs.IndicesTarget, Bits: 1, Rand: mathrand.New(rng)}
+	leaked := 0
+	for f := 0; f < 20; f++ {
+		leaked += len(leaves.Harvest(sphincs.Spx_sign_fault(params, message, sk, faultModel, rng).SIG_FORS))
+	}
+	if leaked == 0 {
+		t.Fatal("no leaves leaked")
+	}
+	md, forgedSignature := leaves.Forge()
+	if md == nil || !leaves.Verify(md, forgedSignature) {
+		t.Fatal("forged FORS signature doesn't verify")
+	}
+}
+
+func TestForsGrafter(t *testing.T) {
+	params := parameters.MakeSphincsPlusToy(false)
+	rng := util.NewDRBG([]byte("FORS grafter"))
+	sk, pk := sphincs.Spx_keygen_rng(params, rng)
+	message := rng.Bytes(params.N)
+	state, err := NewChainState(params, pk, message, sphincs.Spx_sign_rng(params, message, sk, rng), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	faultModel := &sphincs.ForsFault{Target: sphincs.PKForsTarget, Bits: 64, Rand: mathrand.New(rng)}
+	for f := 0; f < 100; f++ {
+		state.Update(params, pk.PKseed, sphincs.Spx_sign_fault(params, message, sk, faultModel, rng).SIG_HT.GetXMSSSignature(0).WotsSignature)
+	}
+	forgedMessage := rng.Bytes(params.N)
+	forgedSignature, _, err := NewForsGrafter(params, pk, state, rng).Forge(forgedMessage, 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !sphincs.Spx_verify(params, forgedMessage, forgedSignature, pk) {
+		t.Fatal("forged signature doesn't verify")
+	}
+}
+
+func TestRemainingSaturates(t *testing.T) {
+	params := parameters.MakeSphincsPlusSHA256256fRobust(false)
+	if keys := NumberOfWOTSKeys(params, 1); keys != math.MaxUint64 {
+		t.Errorf("Expected 2^64 keys in layer 1 to saturate, got %d", keys)
+	}
+	if keys := NumberOfWOTSKeys(params, params.D-1); keys != 1<<params.Hprime {
+		t.Errorf("Expected %d keys in the top layer, got %d", 1<<params.Hprime, keys)
+	}
+	collector := NewCollector(params, nil, nil, []int{0, 1})
+	if remaining := collector.Remaining(); remaining != math.MaxUint64 {
+		t.Errorf("Expected the keys of layers 0 and 1 to saturate, got %d", remaining)
+	}
+}
@@ -0,0 +1,151 @@
+package attack
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/kasperdi/SPHINCSPLUS-golang/parameters"
+	"github.com/kasperdi/SPHINCSPLUS-golang/sphincs"
+)
+
+// SignatureSize returns the length of a signature serialized by SPHINCS_SIG.SerializeSignature, which is the same
+// as the reference implementation's
+func SignatureSize(params *parameters.Parameters) int {
+	return (1 + params.K*(params.A+1) + params.H + params.D*params.Len) * params.N
+}
+
+// ReadCaptures reads the byte strings of length size captured in path, either a file or a directory whose files are
+// read in name order. A file is either hex, with one or more captures on each line, or raw bytes of one or more
+// captures
+func ReadCaptures(path string, size int) ([][]byte, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return readCaptureFile(path, size)
+	}
+	files, err := ioutil.ReadDir(path)
+	if err != nil {
+		return nil, err
+	}
+	captures := make([][]byte, 0)
+	for _, file := range files {
+		if file.IsDir() || strings.HasPrefix(file.Name(), ".") {
+			continue
+		}
+		fileCaptures, err := readCaptureFile(filepath.Join(path, file.Name()), size)
+		if err != nil {
+			return nil, err
+		}
+		captures = append(captures, fileCaptures...)
+	}
+	return captures, nil
+}
+
+// readCaptureFile reads the captures of a single file for ReadCaptures
+func readCaptureFile(filename string, size int) ([][]byte, error) {
+	raw, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	// raw captures are random bytes, so are never only hex digits and whitespace
+	if isHex(raw) {
+		captures := make([][]byte, 0)
+		for i, line := range strings.Fields(string(raw)) {
+			b, err := hex.DecodeString(line)
+			if err != nil {
+				return nil, fmt.Errorf("%s line %d: %s", filename, i+1, err)
+			}
+			lineCaptures, err := splitCaptures(b, size)
+			if err != nil {
+				return nil, fmt.Errorf("%s line %d: %s", filename, i+1, err)
+			}
+			captures = append(captures, lineCaptures...)
+		}
+		return captures, nil
+	}
+	captures, err := splitCaptures(raw, size)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", filename, err)
+	}
+	return captures, nil
+}
+
+// splitCaptures splits b into captures of length size
+func splitCaptures(b []byte, size int) ([][]byte, error) {
+	if len(b) == 0 || len(b)%size != 0 {
+		return nil, fmt.Errorf("%d bytes isn't a multiple of the capture length %d", len(b), size)
+	}
+	captures := make([][]byte, 0, len(b)/size)
+	for i := 0; i < len(b); i += size {
+		captures = append(captures, b[i:i+size])
+	}
+	return captures, nil
+}
+
+func isHex(b []byte) bool {
+	if len(bytes.TrimSpace(b)) == 0 {
+		return false
+	}
+	for _, c := range b {
+		if !strings.ContainsRune("0123456789abcdefABCDEF \t\r\n", rune(c)) {
+			return false
+		}
+	}
+	return true
+}
+
+// ReadSignatures reads the signatures captured in path, as ReadCaptures
+func ReadSignatures(params *parameters.Parameters, path string) ([]*sphincs.SPHINCS_SIG, error) {
+	captures, err := ReadCaptures(path, SignatureSize(params))
+	if err != nil {
+		return nil, err
+	}
+	signatures := make([]*sphincs.SPHINCS_SIG, len(captures))
+	for i, capture := range captures {
+		if signatures[i], err = sphincs.DeserializeSignature(params, capture); err != nil {
+			return nil, err
+		}
+	}
+	return signatures, nil
+}
+
+// ReadPublicKey reads the public key captured in filename, as ReadCaptures
+func ReadPublicKey(params *parameters.Parameters, filename string) (*sphincs.SPHINCS_PK, error) {
+	captures, err := ReadCaptures(filename, 2*params.N)
+	if err != nil {
+		return nil, err
+	}
+	if len(captures) != 1 {
+		return nil, fmt.Errorf("%s holds %d public keys", filename, len(captures))
+	}
+	return sphincs.DeserializePK(params, captures[0])
+}
+
+// ReadMessages reads the messages in filename, one hex encoded message on each line, e.g. the message signed by each
+// capture of a file read by ReadCaptures in the same order
+func ReadMessages(filename string) ([][]byte, error) {
+	raw, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	messages := make([][]byte, 0)
+	for i, line := range strings.Split(string(raw), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		message, err := hex.DecodeString(line)
+		if err != nil {
+			return nil, fmt.Errorf("%s line %d: %s", filename, i+1, err)
+		}
+		messages = append(messages, message)
+	}
+	return messages, nil
+}
@@ -0,0 +1,100 @@
+package attack
+
+import (
+	"errors"
+
+	"github.com/kasperdi/SPHINCSPLUS-golang/hypertree"
+	"github.com/kasperdi/SPHINCSPLUS-golang/parameters"
+	"github.com/kasperdi/SPHINCSPLUS-golang/sphincs"
+)
+
+// ErrInvalidSignature is returned when a signature which should be valid doesn't verify
+var ErrInvalidSignature = errors.New("valid signature doesn't verify")
+
+// ChainState is the attacker's knowledge of a single WOTS key pair: the message it signs in a valid signature, its
+// public key and the shortest hash chains of each block seen so far
+type ChainState struct {
+	Key       WOTSKey
+	Message   []byte // message signed by the key in the valid signature
+	Signature []byte // WOTS signature of Message
+	PublicKey []byte
+	// valid hypertree signature through the key, every layer above Key.Layer is re-used by forgeries
+	Valid *hypertree.HTSignature
+
+	HashCount          []int  // times the secret key of each chain has been hashed in the shortest chain
+	ShortestHashChains []byte // shortest chain value of each block
+
+	walker *ChainWalker // chain values walked through so far
+}
+
+// NewChainState creates the chain state of the WOTS key used in layer by a valid signature of message
+func NewChainState(params *parameters.Parameters, pk *sphincs.SPHINCS_PK, message []byte, signature *sphincs.SPHINCS_SIG, layer int) (*ChainState, error) {
+	success, wotsMsg, wotsSig, _ := sphincs.Spx_verify_get_msg_sig_tree(params, message, signature, pk, layer)
+	if !success {
+		return nil, ErrInvalidSignature
+	}
+	key := KeyFromMsg(params, signature.R, pk, message, layer)
+	return &ChainState{
+		Key:                key,
+		Message:            wotsMsg,
+		Signature:          append([]byte(nil), wotsSig...),
+		PublicKey:          WOTSPKFromSignature(params, wotsSig, wotsMsg, pk.PKseed, key),
+		Valid:              signature.SIG_HT,
+		HashCount:          MsgToBaseW(params, wotsMsg),
+		ShortestHashChains: append([]byte(nil), wotsSig...),
+	}, nil
+}
+
+// Update keeps any block of the WOTS signature sig which is hashed fewer times than the shortest chain found so far.
+// This covers both blocks of a different message and chains which stopped early, while blocks knocked off their hash
+// chain are ignored. Returns true if any chain got shorter
+func (s *ChainState) Update(params *parameters.Parameters, PKseed []byte, sig []byte) bool {
+	// find how far down each hash chain the signature is, this also picks up chains which stopped early
+	return s.UpdatePositions(params, sig, s.Walker(params, PKseed).Positions(sig))
+}
+
+// UpdateBatch is Update for many WOTS signatures by the key, returning true if any chain got shorter
+func (s *ChainState) UpdateBatch(params *parameters.Parameters, PKseed []byte, sigs [][]byte) bool {
+	smaller := false
+	for i, positions := range s.Walker(params, PKseed).BatchPositions(sigs) {
+		smaller = s.UpdatePositions(params, sigs[i], positions) || smaller
+	}
+	return smaller
+}
+
+// Walker returns the chain walker of the key, which starts from the shortest chains found so far
+func (s *ChainState) Walker(params *parameters.Parameters, PKseed []byte) *ChainWalker {
+	if s.walker == nil {
+		s.walker = NewChainWalker(params, PKseed, s.Key, s.PublicKey)
+		s.walker.Learn(s.ShortestHashChains, s.HashCount)
+	}
+	return s.walker
+}
+
+// UpdatePositions is Update with the chain positions of sig already known
+func (s *ChainState) UpdatePositions(params *parameters.Parameters, sig []byte, chainPositions []int) bool {
+	smaller := false
+	for block := 0; block < params.Len; block++ {
+		// blocks knocked off their hash chain are useless
+		if chainPositions[block] == -1 {
+			continue
+		}
+		// if a sig with fewer hashes of a WOTS sk is found, update the shortest hash chain
+		if s.HashCount[block] > chainPositions[block] {
+			smaller = true
+			copy(s.ShortestHashChains[block*params.N:(block+1)*params.N], sig[block*params.N:(block+1)*params.N])
+			s.HashCount[block] = chainPositions[block]
+		}
+	}
+	return smaller
+}
+
+// Signable returns true if the message blocks can be signed with the shortest chains
+func (s *ChainState) Signable(params *parameters.Parameters, messageBlocks []int) bool {
+	return CheckBlocksSignable(params, messageBlocks, s.HashCount)
+}
+
+// Forge forges a WOTS signature of the message blocks, which must be signable
+func (s *ChainState) Forge(params *parameters.Parameters, PKseed []byte, messageBlocks []int) []byte {
+	return ForgeOTSignature(params, s.HashCount, messageBlocks, s.ShortestHashChains, PKseed, s.Key)
+}
@@ -0,0 +1,196 @@
+package attack
+
+import (
+	"bytes"
+	"math"
+
+	"github.com/kasperdi/SPHINCSPLUS-golang/parameters"
+	"github.com/kasperdi/SPHINCSPLUS-golang/sphincs"
+)
+
+// Collector keeps the chain state of every WOTS key of the target layers seen in a valid signature, and routes each
+// faulty signature to the states of the keys it used. Signatures are of Message, or each of its own message with the
+// methods taking one: a key above layer 0 always signs the root of the same subtree, so only the key used has to be
+// recomputed from the message
+type Collector struct {
+	Params       *parameters.Parameters
+	PK           *sphincs.SPHINCS_PK
+	Message      []byte
+	TargetLayers []int
+	States       map[WOTSKey]*ChainState
+}
+
+// FaultyResult is what the collector learnt from a single faulty signature
+type FaultyResult struct {
+	// layers identified as faulted by comparing the target layers with the valid signatures through the same keys
+	FaultedLayers []int
+	// keys of the target layers whose WOTS signature changed
+	Routed []WOTSKey
+	// keys whose hash chains got shorter
+	Shorter []WOTSKey
+	// keys used by the signature which no valid signature has been seen for
+	Unknown []WOTSKey
+	// keys whose message and public key were derived from the signature itself
+	Derived []WOTSKey
+	// whether a layer 0 target key signed a different FORS public key than in its valid signature
+	ForsChanged bool
+}
+
+// NewCollector creates a collector for faulty signatures of message, attacking the WOTS keys of targetLayers
+func NewCollector(params *parameters.Parameters, pk *sphincs.SPHINCS_PK, message []byte, targetLayers []int) *Collector {
+	return &Collector{Params: params, PK: pk, Message: message, TargetLayers: targetLayers, States: make(map[WOTSKey]*ChainState)}
+}
+
+// AddValid adds the keys of a valid signature of Message which haven't been seen before, returning how many were new
+func (c *Collector) AddValid(signature *sphincs.SPHINCS_SIG) (int, error) {
+	return c.AddValidMessage(c.Message, signature)
+}
+
+// AddValidMessage is AddValid for a valid signature of message
+func (c *Collector) AddValidMessage(message []byte, signature *sphincs.SPHINCS_SIG) (int, error) {
+	added := 0
+	for _, targetLayer := range c.TargetLayers {
+		key := KeyFromMsg(c.Params, signature.R, c.PK, message, targetLayer)
+		if _, seen := c.States[key]; seen { // if we already have a signature using this subtree skip
+			continue
+		}
+		state, err := NewChainState(c.Params, c.PK, message, signature, targetLayer)
+		if err != nil {
+			return added, err
+		}
+		c.States[key] = state
+		added += 1
+	}
+	return added, nil
+}
+
+// Remaining returns how many keys of the target layers no valid signature has been seen for, or math.MaxUint64 if
+// the target layers have too many keys to count
+func (c *Collector) Remaining() uint64 {
+	remaining := uint64(0)
+	for _, targetLayer := range c.TargetLayers {
+		keys := NumberOfWOTSKeys(c.Params, targetLayer)
+		if remaining > math.MaxUint64-keys {
+			return math.MaxUint64
+		}
+		remaining += keys
+	}
+	return remaining - uint64(len(c.States))
+}
+
+// AddFaulty identifies the faulted layers of a faulty signature of Message by comparing each target layer with the
+// valid signature through the same WOTS key, and collects the chain values of every target layer whose WOTS signature
+// changed. A correct XMSS signature gives the same root whatever it signs, so a target layer signing a different
+// message means the layer below it was faulted, while a different WOTS signature of the same message means the target
+// layer itself was. For the same reason a signature only fails to verify if the top layer was faulted, which is how a
+// top layer target whose AUTH path alone was faulted is identified
+func (c *Collector) AddFaulty(signature *sphincs.SPHINCS_SIG) *FaultyResult {
+	return c.AddFaultyMessage(c.Message, signature)
+}
+
+// AddFaultyMessage is AddFaulty for a faulty signature of message
+func (c *Collector) AddFaultyMessage(message []byte, signature *sphincs.SPHINCS_SIG) *FaultyResult {
+	verified, msgs := sphincs.Spx_verify_get_msgs(c.Params, message, signature, c.PK)
+	result := new(FaultyResult)
+	for _, targetLayer := range c.TargetLayers {
+		key := KeyFromMsg(c.Params, signature.R, c.PK, message, targetLayer)
+		state, known := c.States[key]
+		if !known {
+			result.Unknown = append(result.Unknown, key)
+			continue
+		}
+		badWotsSignature := signature.SIG_HT.GetXMSSSignature(targetLayer).WotsSignature
+		newMessage := !bytes.Equal(msgs[targetLayer], state.Message)
+		if !newMessage && bytes.Equal(badWotsSignature, state.Signature) {
+			continue
+		}
+		faultedLayer := targetLayer
+		if newMessage {
+			faultedLayer -= 1
+		}
+		// a layer 0 key signs the FORS public key of the message, so a new message there means FORS was faulted
+		if faultedLayer < 0 {
+			result.ForsChanged = true
+		} else {
+			result.addFaultedLayer(faultedLayer)
+		}
+
+		result.Routed = append(result.Routed, key)
+		if state.Update(c.Params, c.PK.PKseed, badWotsSignature) {
+			result.Shorter = append(result.Shorter, key)
+		}
+	}
+	if topLayer := c.Params.D - 1; !verified && containsLayer(c.TargetLayers, topLayer) {
+		if _, known := c.States[KeyFromMsg(c.Params, signature.R, c.PK, message, topLayer)]; known {
+			result.addFaultedLayer(topLayer)
+		}
+	}
+	return result
+}
+
+// Faulted returns whether layer was identified as faulted
+func (r *FaultyResult) Faulted(layer int) bool {
+	return containsLayer(r.FaultedLayers, layer)
+}
+
+func (r *FaultyResult) addFaultedLayer(layer int) {
+	if !r.Faulted(layer) {
+		r.FaultedLayers = append(r.FaultedLayers, layer)
+	}
+}
+
+func containsLayer(layers []int, layer int) bool {
+	for _, l := range layers {
+		if l == layer {
+			return true
+		}
+	}
+	return false
+}
+
+// AddDerived collects a faulty signature of Message without needing any valid signature. Faults which flip bits of
+// the layer below the top layer change the root it signs, which is recomputed from the signature via
+// xmss.Xmss_pkFromSig when verifying. The top layer's WOTS signature is still a correct signature of that faulty root,
+// so if the signature verifies the message and public key of the top layer key are derived from it, and the position
+// of each chain is read off the message rather than searched for. Signatures which don't verify are routed as in
+// AddFaulty. Only the top layer is attacked, as a lower layer's WOTS key can't be told apart from a faulted one
+func (c *Collector) AddDerived(signature *sphincs.SPHINCS_SIG) *FaultyResult {
+	return c.AddDerivedMessage(c.Message, signature)
+}
+
+// AddDerivedMessage is AddDerived for a faulty signature of message
+func (c *Collector) AddDerivedMessage(message []byte, signature *sphincs.SPHINCS_SIG) *FaultyResult {
+	success, msgs := sphincs.Spx_verify_get_msgs(c.Params, message, signature, c.PK)
+	if !success {
+		return c.AddFaultyMessage(message, signature)
+	}
+	result := new(FaultyResult)
+	targetLayer := c.Params.D - 1
+	if !containsLayer(c.TargetLayers, targetLayer) {
+		return result
+	}
+	key := KeyFromMsg(c.Params, signature.R, c.PK, message, targetLayer)
+	state, known := c.States[key]
+	if !known {
+		// the first signature through the key gives its public key, whichever root it signs
+		state, err := NewChainState(c.Params, c.PK, message, signature, targetLayer)
+		if err != nil {
+			return result
+		}
+		c.States[key] = state
+		result.Derived = append(result.Derived, key)
+		return result
+	}
+	if bytes.Equal(msgs[targetLayer], state.Message) {
+		return result
+	}
+
+	// a correct XMSS signature of a different root, so the layer below was faulted
+	result.FaultedLayers = append(result.FaultedLayers, targetLayer-1)
+	result.Routed = append(result.Routed, key)
+	wotsSignature := signature.SIG_HT.GetXMSSSignature(targetLayer).WotsSignature
+	if state.UpdatePositions(c.Params, wotsSignature, MsgToBaseW(c.Params, msgs[targetLayer])) {
+		result.Shorter = append(result.Shorter, key)
+	}
+	return result
+}
@@ -0,0 +1,130 @@
+package attack
+
+import (
+	"errors"
+	"io"
+
+	"github.com/kasperdi/SPHINCSPLUS-golang/hypertree"
+	"github.com/kasperdi/SPHINCSPLUS-golang/parameters"
+	"github.com/kasperdi/SPHINCSPLUS-golang/sphincs"
+	"github.com/kasperdi/SPHINCSPLUS-golang/xmss"
+)
+
+var (
+	// ErrForgeryRejected is returned when a forgery which should have been successful doesn't verify
+	ErrForgeryRejected = errors.New("forged signature doesn't verify")
+	// ErrNoForgery is returned when no forgery could be made in the given number of attempts
+	ErrNoForgery = errors.New("no signable message found in the given attempts")
+)
+
+// Forger forges signatures of new messages by grafting a forged WOTS signature of a key in one of the target layers
+// onto the valid signature through that key. The layers below are signed with a key pair of the forger's own, as the
+// verifier recomputes them from the forged signature
+type Forger struct {
+	Params       *parameters.Parameters
+	PK           *sphincs.SPHINCS_PK
+	TargetLayers []int
+	States       map[WOTSKey]*ChainState
+	Rand         io.Reader // forger's key pair and randomizers
+
+	signature *sphincs.SPHINCS_SIG // forger's signature which every partial signature re-uses
+}
+
+// Attempt is the outcome of trying to forge a signature using a single partial signature
+type Attempt struct {
+	Key           WOTSKey // key the forgery grafts onto
+	MessageBlocks []int   // message blocks the key has to sign
+	HashCount     []int   // shortest hash chains of the key
+	Signable      bool
+	Signature     *sphincs.SPHINCS_SIG // the forgery, if signable
+}
+
+// NewForger creates a forger using the chain states of a collector, drawing its key pairs from rng
+func NewForger(collector *Collector, rng io.Reader) *Forger {
+	return &Forger{Params: collector.Params, PK: collector.PK, TargetLayers: collector.TargetLayers, States: collector.States, Rand: rng}
+}
+
+// PartialSignature returns a signature of message by a key pair of the forger's own, with a randomizer selecting a key
+// in one of the target layers which the forger has the chain state of. The verifier recomputes every layer below the
+// target layer from the signature, so only the randomizer decides which key is used. The forger signs once and draws a
+// new randomizer for each partial signature, which keeps the search cheap for parameter sets with large subtrees
+func (f *Forger) PartialSignature(message []byte) *sphincs.SPHINCS_SIG {
+	if f.signature == nil {
+		fSk, _ := sphincs.Spx_keygen_rng(f.Params, f.Rand)
+		f.signature = sphincs.Spx_sign_rng(f.Params, message, fSk, f.Rand)
+	}
+	R := RandomBytes(f.Rand, f.Params.N)
+	for !f.usesKnownKey(message, R) {
+		R = RandomBytes(f.Rand, f.Params.N)
+	}
+
+	// grafting replaces layers of the partial signature, so each gets its own copy of the XMSS signatures
+	xmssSignatures := make([]*xmss.XMSSSignature, len(f.signature.SIG_HT.XMSSSignatures))
+	for i, xmssSignature := range f.signature.SIG_HT.XMSSSignatures {
+		xmssSignatures[i] = &xmss.XMSSSignature{WotsSignature: xmssSignature.WotsSignature, AUTH: xmssSignature.AUTH}
+	}
+	return &sphincs.SPHINCS_SIG{R: R, SIG_FORS: f.signature.SIG_FORS, SIG_HT: &hypertree.HTSignature{XMSSSignatures: xmssSignatures}}
+}
+
+func (f *Forger) usesKnownKey(message []byte, R []byte) bool {
+	for _, targetLayer := range f.TargetLayers {
+		if _, known := f.States[KeyFromMsg(f.Params, R, f.PK, message, targetLayer)]; known {
+			return true
+		}
+	}
+	return false
+}
+
+// Check finds the first target layer whose key can sign the message partialFSig gives it. If no layer can, the
+// attempt describes the last known key tried
+func (f *Forger) Check(message []byte, partialFSig *sphincs.SPHINCS_SIG) *Attempt {
+	_, msgs := sphincs.Spx_verify_get_msgs(f.Params, message, partialFSig, f.PK)
+	attempt := new(Attempt)
+	for _, targetLayer := range f.TargetLayers {
+		key := KeyFromMsg(f.Params, partialFSig.R, f.PK, message, targetLayer)
+		state, known := f.States[key]
+		if !known {
+			continue
+		}
+		attempt.Key = key
+		attempt.MessageBlocks = MsgToBaseW(f.Params, msgs[targetLayer])
+		attempt.HashCount = state.HashCount
+		if state.Signable(f.Params, attempt.MessageBlocks) {
+			attempt.Signable = true
+			return attempt
+		}
+	}
+	return attempt
+}
+
+// Attempt forges a signature of message from partialFSig if any target layer can sign it. The forgery is checked
+// before it is returned, and ErrForgeryRejected returned if it doesn't verify
+func (f *Forger) Attempt(message []byte, partialFSig *sphincs.SPHINCS_SIG) (*Attempt, error) {
+	attempt := f.Check(message, partialFSig)
+	if !attempt.Signable {
+		return attempt, nil
+	}
+	state := f.States[attempt.Key]
+	fWotsSig := state.Forge(f.Params, f.PK.PKseed, attempt.MessageBlocks)
+	GraftSignature(partialFSig, state.Valid, attempt.Key.Layer, fWotsSig)
+	if !sphincs.Spx_verify(f.Params, message, partialFSig, f.PK) {
+		return attempt, ErrForgeryRejected
+	}
+	attempt.Signature = partialFSig
+	return attempt, nil
+}
+
+// Forge tries up to maxAttempts partial signatures, returning the first forgery of message and the number of
+// attempts it took
+func (f *Forger) Forge(message []byte, maxAttempts int) (*sphincs.SPHINCS_SIG, int, error) {
+	for i := 1; i <= maxAttempts; i++ {
+		attempt, err := f.Attempt(message, f.PartialSignature(message))
+		if err != nil {
+			return nil, i, err
+		}
+		if attempt.Signature != nil {
+			return attempt.Signature, i, nil
+		}
+	}
+	return nil, maxAttempts, ErrNoForgery
+}
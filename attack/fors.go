@@ -0,0 +1,200 @@
+package attack
+
+import (
+	"bytes"
+	"io"
+
+	"github.com/kasperdi/SPHINCSPLUS-golang/address"
+	"github.com/kasperdi/SPHINCSPLUS-golang/fors"
+	"github.com/kasperdi/SPHINCSPLUS-golang/hypertree"
+	"github.com/kasperdi/SPHINCSPLUS-golang/parameters"
+	"github.com/kasperdi/SPHINCSPLUS-golang/sphincs"
+	"github.com/kasperdi/SPHINCSPLUS-golang/xmss"
+)
+
+// ForsLeaves is the attacker's knowledge of a single FORS key pair: the root of each of its FORS trees and the secret
+// leaves revealed in each tree so far, starting with those of a valid signature
+type ForsLeaves struct {
+	Params    *parameters.Parameters
+	PKseed    []byte
+	Adrs      *address.ADRS
+	Indices   []int // leaves revealed by the valid signature
+	PublicKey []byte
+	Roots     [][]byte
+	Leaves    []map[int]*fors.TreePKAUTH
+}
+
+// NewForsLeaves creates the leaf state of the FORS key pair used by a valid signature of message
+func NewForsLeaves(params *parameters.Parameters, pk *sphincs.SPHINCS_PK, message []byte, signature *sphincs.SPHINCS_SIG) *ForsLeaves {
+	md, idxTree, idxLeaf := Digest(params, signature.R, pk, message)
+	adrs := new(address.ADRS)
+	adrs.SetTreeAddress(idxTree)
+	adrs.SetType(address.FORS_TREE)
+	adrs.SetKeyPairAddress(idxLeaf)
+
+	l := &ForsLeaves{
+		Params:    params,
+		PKseed:    pk.PKseed,
+		Adrs:      adrs,
+		Indices:   fors.MessageToIndices(params, md),
+		PublicKey: fors.Fors_pkFromSig(params, signature.SIG_FORS, md, pk.PKseed, adrs),
+		Roots:     make([][]byte, params.K),
+		Leaves:    make([]map[int]*fors.TreePKAUTH, params.K),
+	}
+	for i := 0; i < params.K; i++ {
+		l.Roots[i] = fors.Fors_treeRoot(params, signature.SIG_FORS.GetSK(i), signature.SIG_FORS.GetAUTH(i), i, l.Indices[i], pk.PKseed, adrs)
+		l.Leaves[i] = map[int]*fors.TreePKAUTH{l.Indices[i]: signature.SIG_FORS.Forspkauth[i]}
+	}
+	return l
+}
+
+// Harvest finds the leaves a faulty FORS signature by the key pair reveals, returning the FORS trees it leaked a new
+// leaf of
+func (l *ForsLeaves) Harvest(signature *fors.FORSSignature) []int {
+	leaked := make([]int, 0)
+	for i := 0; i < l.Params.K; i++ {
+		if l.HarvestTree(signature.Forspkauth[i], i) {
+			leaked = append(leaked, i)
+		}
+	}
+	return leaked
+}
+
+// HarvestTree finds which leaf of FORS tree i the secret value of a faulty signature belongs to, by checking which
+// index its AUTH path leads to the tree's root from. Returns true if it is a newly leaked leaf
+func (l *ForsLeaves) HarvestTree(treePKAUTH *fors.TreePKAUTH, i int) bool {
+	for index, known := range l.Leaves[i] {
+		if bytes.Equal(known.PrivateKeyValue, treePKAUTH.PrivateKeyValue) {
+			return false
+		}
+		// most faults leave the index alone, so check the known leaves first
+		if l.leadsToRoot(treePKAUTH, i, index) {
+			return false
+		}
+	}
+	for index := 0; index < l.Params.T; index++ {
+		if _, ok := l.Leaves[i][index]; ok {
+			continue
+		}
+		if l.leadsToRoot(treePKAUTH, i, index) {
+			l.Leaves[i][index] = treePKAUTH
+			return true
+		}
+	}
+	// corrupted values don't lead to the root from any leaf
+	return false
+}
+
+func (l *ForsLeaves) leadsToRoot(treePKAUTH *fors.TreePKAUTH, i int, index int) bool {
+	root := fors.Fors_treeRoot(l.Params, treePKAUTH.PrivateKeyValue, treePKAUTH.AUTH, i, index, l.PKseed, l.Adrs)
+	return bytes.Equal(root, l.Roots[i])
+}
+
+// SignableFraction returns the chance that a random FORS message can be signed with the known leaves
+func (l *ForsLeaves) SignableFraction() float64 {
+	signable := 1.0
+	for i := 0; i < l.Params.K; i++ {
+		signable *= float64(len(l.Leaves[i])) / float64(l.Params.T)
+	}
+	return signable
+}
+
+// Forge creates a FORS signature for a FORS message made up of known leaves, using a leaked leaf instead of the
+// validly signed one wherever possible. Returns nil if no leaves were leaked
+func (l *ForsLeaves) Forge() ([]byte, *fors.FORSSignature) {
+	forgedIndices := make([]int, l.Params.K)
+	forgedSignature := new(fors.FORSSignature)
+	leaked := false
+	for i := 0; i < l.Params.K; i++ {
+		forgedIndices[i] = l.Indices[i]
+		for index := range l.Leaves[i] {
+			if index != l.Indices[i] {
+				forgedIndices[i] = index
+				leaked = true
+				break
+			}
+		}
+		forgedSignature.Forspkauth = append(forgedSignature.Forspkauth, l.Leaves[i][forgedIndices[i]])
+	}
+	if !leaked {
+		return nil, nil
+	}
+	return fors.IndicesToMessage(l.Params, forgedIndices), forgedSignature
+}
+
+// Verify checks that a FORS signature of md gives the public key of the key pair
+func (l *ForsLeaves) Verify(md []byte, signature *fors.FORSSignature) bool {
+	return bytes.Equal(fors.Fors_pkFromSig(l.Params, signature, md, l.PKseed, l.Adrs.Copy()), l.PublicKey)
+}
+
+// ForsGrafter forges signatures through a layer 0 WOTS key whose chain values leaked from faults of the FORS public
+// key it signs. A forgery grafts a FORS key pair of the attacker's own under the key, which needs a randomizer whose
+// message digest selects the key's leaf, found by searching 2^H digests on average. A FORS public key doesn't depend
+// on the message it signs, so each attempt draws a new FORS key pair for the WOTS key to sign
+type ForsGrafter struct {
+	Params *parameters.Parameters
+	PK     *sphincs.SPHINCS_PK
+	State  *ChainState // chain state of the layer 0 key
+	Rand   io.Reader   // attacker's FORS key pairs and randomizers
+}
+
+// NewForsGrafter creates a grafter forging through the layer 0 key of state, drawing its FORS key pairs from rng
+func NewForsGrafter(params *parameters.Parameters, pk *sphincs.SPHINCS_PK, state *ChainState, rng io.Reader) *ForsGrafter {
+	return &ForsGrafter{Params: params, PK: pk, State: state, Rand: rng}
+}
+
+// Randomizer searches for a randomizer which makes message use the attacked layer 0 leaf
+func (g *ForsGrafter) Randomizer(message []byte) []byte {
+	R := RandomBytes(g.Rand, g.Params.N)
+	for KeyFromMsg(g.Params, R, g.PK, message, 0) != g.State.Key {
+		R = RandomBytes(g.Rand, g.Params.N)
+	}
+	return R
+}
+
+// Attempt signs the FORS message of message and R, which must use the attacked leaf, with a new FORS key pair of the
+// attacker's own. If the WOTS key can sign its public key, the layer 0 WOTS signature is forged and every layer above
+// is taken from the valid signature. The forgery is checked before it is returned, and ErrForgeryRejected returned if
+// it doesn't verify. Returns a nil signature if the attempt couldn't be signed
+func (g *ForsGrafter) Attempt(message []byte, R []byte) (*sphincs.SPHINCS_SIG, error) {
+	md, idxTree, idxLeaf := Digest(g.Params, R, g.PK, message)
+
+	// the attacker's FORS key pair, hashed with the victim's PKseed and addresses
+	forsSKseed := RandomBytes(g.Rand, g.Params.N)
+	adrs := new(address.ADRS)
+	adrs.SetTreeAddress(idxTree)
+	adrs.SetType(address.FORS_TREE)
+	adrs.SetKeyPairAddress(idxLeaf)
+	SIG_FORS := fors.Fors_sign(g.Params, md, forsSKseed, g.PK.PKseed, adrs.Copy())
+	PK_FORS := fors.Fors_pkFromSig(g.Params, SIG_FORS, md, g.PK.PKseed, adrs)
+
+	messageBlocks := MsgToBaseW(g.Params, PK_FORS)
+	if !g.State.Signable(g.Params, messageBlocks) {
+		return nil, nil
+	}
+
+	forgedSignature := &sphincs.SPHINCS_SIG{R: R, SIG_FORS: SIG_FORS,
+		SIG_HT: &hypertree.HTSignature{XMSSSignatures: make([]*xmss.XMSSSignature, g.Params.D)}}
+	forgedSignature.SIG_HT.XMSSSignatures[0] = new(xmss.XMSSSignature)
+	GraftSignature(forgedSignature, g.State.Valid, 0, g.State.Forge(g.Params, g.PK.PKseed, messageBlocks))
+	if !sphincs.Spx_verify(g.Params, message, forgedSignature, g.PK) {
+		return nil, ErrForgeryRejected
+	}
+	return forgedSignature, nil
+}
+
+// Forge searches for a randomizer once and tries up to maxAttempts FORS key pairs with it, returning the first forgery
+// of message and the number of attempts it took
+func (g *ForsGrafter) Forge(message []byte, maxAttempts int) (*sphincs.SPHINCS_SIG, int, error) {
+	R := g.Randomizer(message)
+	for i := 1; i <= maxAttempts; i++ {
+		signature, err := g.Attempt(message, R)
+		if err != nil {
+			return nil, i, err
+		}
+		if signature != nil {
+			return signature, i, nil
+		}
+	}
+	return nil, maxAttempts, ErrNoForgery
+}
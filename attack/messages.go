@@ -0,0 +1,34 @@
+package attack
+
+import (
+	"io"
+
+	"github.com/kasperdi/SPHINCSPLUS-golang/util"
+)
+
+// MessageSource gives the message of every signing query of an attack. Real targets often sign messages the attacker
+// sees but doesn't choose, so a distinct source signs a new random message every query instead of the attacked one
+type MessageSource struct {
+	message []byte
+	rng     io.Reader
+}
+
+// NewMessageSource returns a source signing message in every query
+func NewMessageSource(message []byte) *MessageSource {
+	return &MessageSource{message: message}
+}
+
+// NewDistinctMessageSource returns a source signing a new random message of the length of message in every query.
+// The messages are derived from seed alone, so they are the same whichever oracle answers them, and a transcript
+// recorded with them replays with the same seed
+func NewDistinctMessageSource(message []byte, seed []byte) *MessageSource {
+	return &MessageSource{message: message, rng: util.NewDRBG(append([]byte("distinct messages"), seed...))}
+}
+
+// Next returns the message of the next query
+func (s *MessageSource) Next() []byte {
+	if s.rng == nil {
+		return s.message
+	}
+	return RandomBytes(s.rng, len(s.message))
+}
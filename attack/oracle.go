@@ -0,0 +1,25 @@
+package attack
+
+import (
+	"errors"
+
+	"github.com/kasperdi/SPHINCSPLUS-golang/sphincs"
+)
+
+// ErrOracleClosed is returned when querying a signing oracle after it was closed
+var ErrOracleClosed = errors.New("signing oracle is closed")
+
+// SigningOracle is a signer whose secret key the attack never sees. It can be simulated in process, replay recorded
+// signatures or talk to a remote signer, and the attack only learns what it returns
+type SigningOracle interface {
+	// PublicKey returns the public key of the signer
+	PublicKey() *sphincs.SPHINCS_PK
+	// Sign signs message correctly
+	Sign(message []byte) (*sphincs.SPHINCS_SIG, error)
+	// SignFaulty signs message with a fault injected, which might not have changed the signature
+	SignFaulty(message []byte) (*sphincs.SPHINCS_SIG, error)
+	// Queries returns the number of valid and faulty signing queries answered so far
+	Queries() (valid int, faulty int)
+	// Close stops the signer. No queries can be made after
+	Close() error
+}
@@ -0,0 +1,221 @@
+package attack
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+
+	"github.com/kasperdi/SPHINCSPLUS-golang/parameters"
+	"github.com/kasperdi/SPHINCSPLUS-golang/sphincs"
+)
+
+// Remote oracles talk over a stream in frames of a 4 byte big endian length followed by the body. A request body is
+// an operation byte followed by its argument, and a response body is a status byte followed by the result or, if the
+// status isn't statusOK, an error message
+const (
+	opParams     byte = 'N' // returns the name of the parameter set
+	opPublicKey  byte = 'P' // returns the public key, as serialized by SPHINCS_PK.SerializePK
+	opSign       byte = 'S' // signs the argument, returning the signature serialized by SPHINCS_SIG.SerializeSignature
+	opSignFaulty byte = 'F' // signs the argument with a fault injected, as opSign
+
+	statusOK    byte = 0
+	statusError byte = 1
+
+	// larger than any SPHINCS+ signature, so a corrupt length can't make either side allocate without bound
+	maxFrameLength = 1 << 20
+)
+
+// ErrFrameLength is returned when a remote oracle frame is longer than any valid request or response
+var ErrFrameLength = errors.New("remote oracle frame too long")
+
+// ServeOracle answers the queries of remote oracle clients on every connection accepted by listener, passing them
+// to oracle. paramSet names the parameter set of the oracle, so clients can check they use the same one. It returns
+// once listener is closed, leaving connected clients to fail once oracle is closed
+func ServeOracle(listener net.Listener, oracle SigningOracle, paramSet string) error {
+	pk, err := oracle.PublicKey().SerializePK()
+	if err != nil {
+		return err
+	}
+	for {
+		conn, err := listener.Accept()
+		if errors.Is(err, net.ErrClosed) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		go func() {
+			defer conn.Close()
+			serveConnection(conn, oracle, paramSet, pk)
+		}()
+	}
+}
+
+// serveConnection answers the queries of a single client until it disconnects
+func serveConnection(conn io.ReadWriter, oracle SigningOracle, paramSet string, pk []byte) {
+	for {
+		request, err := readFrame(conn)
+		if err != nil || len(request) == 0 {
+			return
+		}
+		var result []byte
+		switch request[0] {
+		case opParams:
+			result = []byte(paramSet)
+		case opPublicKey:
+			result = pk
+		case opSign, opSignFaulty:
+			var signature *sphincs.SPHINCS_SIG
+			if request[0] == opSign {
+				signature, err = oracle.Sign(request[1:])
+			} else {
+				signature, err = oracle.SignFaulty(request[1:])
+			}
+			if err == nil {
+				result, err = signature.SerializeSignature()
+			}
+		default:
+			err = fmt.Errorf("unknown operation %q", request[0])
+		}
+		response := append([]byte{statusOK}, result...)
+		if err != nil {
+			response = append([]byte{statusError}, err.Error()...)
+		}
+		if writeFrame(conn, response) != nil {
+			return
+		}
+	}
+}
+
+// RemoteOracle is a signing oracle answered by ServeOracle in another process
+type RemoteOracle struct {
+	params      *parameters.Parameters
+	conn        net.Conn
+	pk          *sphincs.SPHINCS_PK
+	mutex       sync.Mutex
+	validSigns  int
+	faultySigns int
+	closed      bool
+}
+
+// DialOracle connects to the oracle served at address on network, e.g. "tcp" or "unix". The oracle must be using
+// the parameter set named paramSet, which params are
+func DialOracle(network string, address string, params *parameters.Parameters, paramSet string) (*RemoteOracle, error) {
+	conn, err := net.Dial(network, address)
+	if err != nil {
+		return nil, err
+	}
+	o := &RemoteOracle{params: params, conn: conn}
+	name, err := o.query(opParams, nil)
+	if err == nil && string(name) != paramSet {
+		err = fmt.Errorf("oracle uses parameter set %s", name)
+	}
+	var pk []byte
+	if err == nil {
+		pk, err = o.query(opPublicKey, nil)
+	}
+	if err == nil {
+		o.pk, err = sphincs.DeserializePK(params, pk)
+	}
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return o, nil
+}
+
+func (o *RemoteOracle) PublicKey() *sphincs.SPHINCS_PK {
+	return o.pk
+}
+
+func (o *RemoteOracle) Sign(message []byte) (*sphincs.SPHINCS_SIG, error) {
+	return o.sign(opSign, message)
+}
+
+func (o *RemoteOracle) SignFaulty(message []byte) (*sphincs.SPHINCS_SIG, error) {
+	return o.sign(opSignFaulty, message)
+}
+
+func (o *RemoteOracle) Queries() (int, int) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	return o.validSigns, o.faultySigns
+}
+
+// Close disconnects from the oracle, which keeps serving other clients
+func (o *RemoteOracle) Close() error {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	if o.closed {
+		return ErrOracleClosed
+	}
+	o.closed = true
+	return o.conn.Close()
+}
+
+func (o *RemoteOracle) sign(op byte, message []byte) (*sphincs.SPHINCS_SIG, error) {
+	signature, err := o.query(op, message)
+	if err != nil {
+		return nil, err
+	}
+	o.mutex.Lock()
+	if op == opSign {
+		o.validSigns += 1
+	} else {
+		o.faultySigns += 1
+	}
+	o.mutex.Unlock()
+	return sphincs.DeserializeSignature(o.params, signature)
+}
+
+// query sends a single request to the oracle and waits for its response
+func (o *RemoteOracle) query(op byte, argument []byte) ([]byte, error) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	if o.closed {
+		return nil, ErrOracleClosed
+	}
+	if err := writeFrame(o.conn, append([]byte{op}, argument...)); err != nil {
+		return nil, err
+	}
+	response, err := readFrame(o.conn)
+	if err != nil {
+		return nil, err
+	}
+	if len(response) == 0 {
+		return nil, errors.New("empty response from remote oracle")
+	}
+	if response[0] != statusOK {
+		return nil, fmt.Errorf("remote oracle: %s", response[1:])
+	}
+	return response[1:], nil
+}
+
+func writeFrame(w io.Writer, body []byte) error {
+	if len(body) > maxFrameLength {
+		return ErrFrameLength
+	}
+	frame := make([]byte, 4, 4+len(body))
+	binary.BigEndian.PutUint32(frame, uint32(len(body)))
+	_, err := w.Write(append(frame, body...))
+	return err
+}
+
+func readFrame(r io.Reader) ([]byte, error) {
+	var length [4]byte
+	if _, err := io.ReadFull(r, length[:]); err != nil {
+		return nil, err
+	}
+	n := binary.BigEndian.Uint32(length[:])
+	if n > maxFrameLength {
+		return nil, ErrFrameLength
+	}
+	body := make([]byte, n)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, err
+	}
+	return body, nil
+}
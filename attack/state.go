@@ -0,0 +1,225 @@
+package attack
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+
+	"github.com/kasperdi/SPHINCSPLUS-golang/hypertree"
+	"github.com/kasperdi/SPHINCSPLUS-golang/parameters"
+	"github.com/kasperdi/SPHINCSPLUS-golang/sphincs"
+	"github.com/kasperdi/SPHINCSPLUS-golang/xmss"
+)
+
+// StateVersion is the version of the attack state format written by WriteState
+const StateVersion = 1
+
+// ErrStateVersion is returned when reading an attack state written in another version of the format
+var ErrStateVersion = errors.New("unsupported attack state version")
+
+// State is the on-disk form of a collector, so a long fault collection can be resumed, or forgeries made, later. Byte
+// strings are hex encoded
+type State struct {
+	Version      int        `json:"version"`
+	Params       string     `json:"params"` // parameter set, e.g. sha256-256f-robust
+	Randomize    bool       `json:"randomize"`
+	PK           string     `json:"pk"`      // as serialized by SPHINCS_PK.SerializePK
+	Message      string     `json:"message"` // message whose faulty signatures are collected
+	TargetLayers []int      `json:"targetLayers"`
+	Keys         []KeyState `json:"keys"`
+	// fields of the tool which saved the state, e.g. what it needs to resume signing
+	Meta map[string]string `json:"meta,omitempty"`
+}
+
+// KeyState is the on-disk form of a ChainState
+type KeyState struct {
+	Layer              int    `json:"layer"`
+	Tree               uint64 `json:"tree"`
+	Leaf               int    `json:"leaf"`
+	Message            string `json:"message"`
+	Signature          string `json:"signature"`
+	PublicKey          string `json:"publicKey"`
+	HashCount          []int  `json:"hashCount"`
+	ShortestHashChains string `json:"shortestHashChains"`
+	// XMSS signatures of the valid signature through the key, from its layer to the top layer
+	Valid []XMSSState `json:"valid"`
+}
+
+// XMSSState is the on-disk form of an XMSS signature
+type XMSSState struct {
+	WotsSignature string `json:"wotsSignature"`
+	AUTH          string `json:"auth"`
+}
+
+// NewState converts the collector to its on-disk form, naming its parameter set paramSet
+func NewState(collector *Collector, paramSet string) (*State, error) {
+	pk, err := collector.PK.SerializePK()
+	if err != nil {
+		return nil, err
+	}
+	state := &State{
+		Version:      StateVersion,
+		Params:       paramSet,
+		Randomize:    collector.Params.RANDOMIZE,
+		PK:           hex.EncodeToString(pk),
+		Message:      hex.EncodeToString(collector.Message),
+		TargetLayers: collector.TargetLayers,
+		Keys:         make([]KeyState, 0, len(collector.States)),
+	}
+	for key, chainState := range collector.States {
+		keyState := KeyState{
+			Layer:              key.Layer,
+			Tree:               key.Tree,
+			Leaf:               key.Leaf,
+			Message:            hex.EncodeToString(chainState.Message),
+			Signature:          hex.EncodeToString(chainState.Signature),
+			PublicKey:          hex.EncodeToString(chainState.PublicKey),
+			HashCount:          chainState.HashCount,
+			ShortestHashChains: hex.EncodeToString(chainState.ShortestHashChains),
+		}
+		// forgeries only re-use the layers from the key upwards
+		for _, xmssSignature := range chainState.Valid.XMSSSignatures[key.Layer:] {
+			keyState.Valid = append(keyState.Valid, XMSSState{
+				WotsSignature: hex.EncodeToString(xmssSignature.WotsSignature),
+				AUTH:          hex.EncodeToString(xmssSignature.AUTH),
+			})
+		}
+		state.Keys = append(state.Keys, keyState)
+	}
+	// keep the file the same for the same collector
+	sort.Slice(state.Keys, func(i, j int) bool {
+		a, b := state.Keys[i], state.Keys[j]
+		if a.Layer != b.Layer {
+			return a.Layer < b.Layer
+		}
+		if a.Tree != b.Tree {
+			return a.Tree < b.Tree
+		}
+		return a.Leaf < b.Leaf
+	})
+	return state, nil
+}
+
+// Collector recreates the collector saved in the state, which must have been saved with params
+func (s *State) Collector(params *parameters.Parameters) (*Collector, error) {
+	if params.RANDOMIZE != s.Randomize {
+		return nil, fmt.Errorf("state was saved with randomize %t", s.Randomize)
+	}
+	pkBytes, err := decodeHex("pk", s.PK, 2*params.N)
+	if err != nil {
+		return nil, err
+	}
+	pk, err := sphincs.DeserializePK(params, pkBytes)
+	if err != nil {
+		return nil, err
+	}
+	message, err := hex.DecodeString(s.Message)
+	if err != nil {
+		return nil, fmt.Errorf("message: %s", err)
+	}
+	for _, layer := range s.TargetLayers {
+		if layer < 0 || layer >= params.D {
+			return nil, fmt.Errorf("target layer %d isn't in the hypertree", layer)
+		}
+	}
+
+	collector := NewCollector(params, pk, message, s.TargetLayers)
+	for _, keyState := range s.Keys {
+		chainState, err := keyState.chainState(params)
+		if err != nil {
+			return nil, fmt.Errorf("layer %d WOTS key %d of tree %d: %s", keyState.Layer, keyState.Leaf, keyState.Tree, err)
+		}
+		collector.States[chainState.Key] = chainState
+	}
+	return collector, nil
+}
+
+func (k *KeyState) chainState(params *parameters.Parameters) (*ChainState, error) {
+	if k.Layer < 0 || k.Layer >= params.D || len(k.Valid) != params.D-k.Layer {
+		return nil, errors.New("layers don't match the parameter set")
+	}
+	if len(k.HashCount) != params.Len {
+		return nil, errors.New("hashCount is of incorrect length")
+	}
+	for _, count := range k.HashCount {
+		if count < 0 || count >= params.W {
+			return nil, errors.New("hashCount is out of range")
+		}
+	}
+	state := &ChainState{Key: WOTSKey{Layer: k.Layer, Tree: k.Tree, Leaf: k.Leaf}, HashCount: k.HashCount}
+	var err error
+	if state.Message, err = decodeHex("message", k.Message, params.N); err != nil {
+		return nil, err
+	}
+	if state.Signature, err = decodeHex("signature", k.Signature, params.Len*params.N); err != nil {
+		return nil, err
+	}
+	if state.PublicKey, err = decodeHex("publicKey", k.PublicKey, params.Len*params.N); err != nil {
+		return nil, err
+	}
+	if state.ShortestHashChains, err = decodeHex("shortestHashChains", k.ShortestHashChains, params.Len*params.N); err != nil {
+		return nil, err
+	}
+
+	// the layers below the key aren't saved, forgeries sign them with the forger's own key pair
+	state.Valid = &hypertree.HTSignature{XMSSSignatures: make([]*xmss.XMSSSignature, params.D)}
+	for layer := 0; layer < params.D; layer++ {
+		xmssSignature := new(xmss.XMSSSignature)
+		if layer >= k.Layer {
+			valid := k.Valid[layer-k.Layer]
+			if xmssSignature.WotsSignature, err = decodeHex("valid wotsSignature", valid.WotsSignature, params.Len*params.N); err != nil {
+				return nil, err
+			}
+			if xmssSignature.AUTH, err = decodeHex("valid auth", valid.AUTH, params.Hprime*params.N); err != nil {
+				return nil, err
+			}
+		}
+		state.Valid.XMSSSignatures[layer] = xmssSignature
+	}
+	return state, nil
+}
+
+// decodeHex decodes a hex field of the state, which must be length bytes long
+func decodeHex(field string, s string, length int) ([]byte, error) {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", field, err)
+	}
+	if len(b) != length {
+		return nil, fmt.Errorf("%s is of incorrect length", field)
+	}
+	return b, nil
+}
+
+// WriteState writes the state to filename. It is written to a temporary file first, so an interrupted write never
+// leaves a partial state behind
+func WriteState(filename string, state *State) error {
+	raw, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(filename+".tmp", raw, 0644); err != nil {
+		return err
+	}
+	return os.Rename(filename+".tmp", filename)
+}
+
+// ReadState reads a state written by WriteState
+func ReadState(filename string) (*State, error) {
+	raw, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	state := new(State)
+	if err := json.Unmarshal(raw, state); err != nil {
+		return nil, err
+	}
+	if state.Version != StateVersion {
+		return nil, ErrStateVersion
+	}
+	return state, nil
+}
@@ -0,0 +1,224 @@
+package attack
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/kasperdi/SPHINCSPLUS-golang/parameters"
+	"github.com/kasperdi/SPHINCSPLUS-golang/sphincs"
+)
+
+// ErrTranscriptEnd is returned by a replay oracle once every signature of the kind queried has been served
+var ErrTranscriptEnd = errors.New("no more signatures in transcript")
+
+// TranscriptEntry is a line of a transcript, a file of JSON lines which is only ever appended to. Every recording
+// oracle writes an entry with the parameter set and public key before its queries, then an entry for every query
+type TranscriptEntry struct {
+	Time      time.Time `json:"time"`
+	Params    string    `json:"params,omitempty"`
+	PK        string    `json:"pk,omitempty"` // as serialized by SPHINCS_PK.SerializePK
+	Faulty    bool      `json:"faulty,omitempty"`
+	Message   string    `json:"message,omitempty"`
+	Signature string    `json:"signature,omitempty"` // as serialized by SPHINCS_SIG.SerializeSignature
+}
+
+// RecordingOracle passes queries to another oracle, appending each query and its response to a transcript
+type RecordingOracle struct {
+	SigningOracle
+	file  *os.File
+	mutex sync.Mutex
+}
+
+// NewRecordingOracle records the queries made to oracle, of parameter set paramSet, to the transcript filename,
+// creating it if it doesn't exist
+func NewRecordingOracle(oracle SigningOracle, filename string, paramSet string) (*RecordingOracle, error) {
+	pk, err := oracle.PublicKey().SerializePK()
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(filename, os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	o := &RecordingOracle{SigningOracle: oracle, file: file}
+	if err := o.write(TranscriptEntry{Params: paramSet, PK: hex.EncodeToString(pk)}); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return o, nil
+}
+
+func (o *RecordingOracle) Sign(message []byte) (*sphincs.SPHINCS_SIG, error) {
+	signature, err := o.SigningOracle.Sign(message)
+	if err != nil {
+		return nil, err
+	}
+	return signature, o.record(false, message, signature)
+}
+
+func (o *RecordingOracle) SignFaulty(message []byte) (*sphincs.SPHINCS_SIG, error) {
+	signature, err := o.SigningOracle.SignFaulty(message)
+	if err != nil {
+		return nil, err
+	}
+	return signature, o.record(true, message, signature)
+}
+
+// Close closes the recorded oracle and the transcript
+func (o *RecordingOracle) Close() error {
+	err := o.SigningOracle.Close()
+	if fileErr := o.file.Close(); err == nil {
+		err = fileErr
+	}
+	return err
+}
+
+func (o *RecordingOracle) record(faulty bool, message []byte, signature *sphincs.SPHINCS_SIG) error {
+	serialized, err := signature.SerializeSignature()
+	if err != nil {
+		return err
+	}
+	return o.write(TranscriptEntry{Faulty: faulty, Message: hex.EncodeToString(message), Signature: hex.EncodeToString(serialized)})
+}
+
+// write appends a single line to the transcript, so an interrupted attack leaves every earlier query intact
+func (o *RecordingOracle) write(entry TranscriptEntry) error {
+	entry.Time = time.Now().UTC()
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	_, err = o.file.Write(append(line, '\n'))
+	return err
+}
+
+// ReplayOracle serves the signatures of a transcript back in the order they were recorded, valid and faulty
+// signatures each in their own order, so an attack can be rerun on exactly the same signatures
+type ReplayOracle struct {
+	pk          *sphincs.SPHINCS_PK
+	valid       []TranscriptEntry
+	faulty      []TranscriptEntry
+	params      *parameters.Parameters
+	mutex       sync.Mutex
+	validSigns  int
+	faultySigns int
+	closed      bool
+}
+
+// NewReplayOracle reads the transcript filename, which must have been recorded with the parameter set paramSet,
+// which params are, and by a single key pair
+func NewReplayOracle(params *parameters.Parameters, filename string, paramSet string) (*ReplayOracle, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	o := &ReplayOracle{params: params}
+	var pk []byte
+	scanner := bufio.NewScanner(file)
+	// a line holds a whole signature as hex
+	scanner.Buffer(make([]byte, 0, 64*1024), 4*maxFrameLength)
+	for line := 1; scanner.Scan(); line++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		var entry TranscriptEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, fmt.Errorf("%s line %d: %s", filename, line, err)
+		}
+		if entry.PK != "" {
+			if entry.Params != paramSet {
+				return nil, fmt.Errorf("%s line %d: recorded with parameter set %s", filename, line, entry.Params)
+			}
+			entryPK, err := decodeHex("pk", entry.PK, 2*params.N)
+			if err != nil {
+				return nil, fmt.Errorf("%s line %d: %s", filename, line, err)
+			}
+			if pk != nil && !bytes.Equal(pk, entryPK) {
+				return nil, fmt.Errorf("%s line %d: recorded with another key pair", filename, line)
+			}
+			pk = entryPK
+			continue
+		}
+		if pk == nil {
+			return nil, fmt.Errorf("%s line %d: query before the public key", filename, line)
+		}
+		if entry.Faulty {
+			o.faulty = append(o.faulty, entry)
+		} else {
+			o.valid = append(o.valid, entry)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if pk == nil {
+		return nil, fmt.Errorf("%s holds no public key", filename)
+	}
+	if o.pk, err = sphincs.DeserializePK(params, pk); err != nil {
+		return nil, err
+	}
+	return o, nil
+}
+
+func (o *ReplayOracle) PublicKey() *sphincs.SPHINCS_PK {
+	return o.pk
+}
+
+func (o *ReplayOracle) Sign(message []byte) (*sphincs.SPHINCS_SIG, error) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	return o.next(o.valid, &o.validSigns, message)
+}
+
+func (o *ReplayOracle) SignFaulty(message []byte) (*sphincs.SPHINCS_SIG, error) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	return o.next(o.faulty, &o.faultySigns, message)
+}
+
+func (o *ReplayOracle) Queries() (int, int) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	return o.validSigns, o.faultySigns
+}
+
+func (o *ReplayOracle) Close() error {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	if o.closed {
+		return ErrOracleClosed
+	}
+	o.closed = true
+	return nil
+}
+
+// next serves the next of entries, which must sign message, counting it in served
+func (o *ReplayOracle) next(entries []TranscriptEntry, served *int, message []byte) (*sphincs.SPHINCS_SIG, error) {
+	if o.closed {
+		return nil, ErrOracleClosed
+	}
+	if *served == len(entries) {
+		return nil, ErrTranscriptEnd
+	}
+	entry := entries[*served]
+	if entry.Message != hex.EncodeToString(message) {
+		return nil, fmt.Errorf("transcript signs %s next, not %x", entry.Message, message)
+	}
+	signature, err := hex.DecodeString(entry.Signature)
+	if err != nil {
+		return nil, err
+	}
+	*served += 1
+	return sphincs.DeserializeSignature(o.params, signature)
+}
@@ -0,0 +1,114 @@
+package attack
+
+import (
+	"bytes"
+
+	"github.com/kasperdi/SPHINCSPLUS-golang/parameters"
+)
+
+// ChainWalker finds the positions of WOTS signature blocks on the hash chains of a single WOTS key. It keeps every
+// chain value known so far, from the public key down to the lowest position seen, so a block at or above the lowest
+// position is found by comparison alone. A block below it is stepped forward one F call at a time from each candidate
+// position until it reaches the lowest known value, and every value on the way is kept for later signatures.
+//
+// A block knocked off its chain never reaches it, so every candidate position is tried: lowest*(lowest+1)/2 F calls,
+// at most W*(W-1)/2 (120 for W=16) however many values of the chain are known. Values found to be off the chain stay
+// off it as the lowest position moves down, so each is only walked once and compared after that
+type ChainWalker struct {
+	params   *parameters.Parameters
+	PKseed   []byte
+	Key      WOTSKey
+	values   [][][]byte        // values[block][position], nil below the lowest known position
+	lowest   []int             // lowest known position of each chain
+	offChain []map[string]bool // values of each block known not to be on its chain
+}
+
+// NewChainWalker creates a walker for the WOTS key with public key pk, knowing only the end of every chain
+func NewChainWalker(params *parameters.Parameters, PKseed []byte, key WOTSKey, pk []byte) *ChainWalker {
+	w := &ChainWalker{params: params, PKseed: PKseed, Key: key, values: make([][][]byte, params.Len), lowest: make([]int, params.Len),
+		offChain: make([]map[string]bool, params.Len)}
+	for block := 0; block < params.Len; block++ {
+		w.values[block] = make([][]byte, params.W)
+		w.offChain[block] = make(map[string]bool)
+		w.values[block][params.W-1] = append([]byte(nil), pk[block*params.N:(block+1)*params.N]...)
+		w.lowest[block] = params.W - 1
+	}
+	return w
+}
+
+// Learn adds a signature whose chain positions are already known, e.g. a valid signature of a known message, so
+// later signatures are compared against it. Returns false if a block doesn't reach the known chain
+func (w *ChainWalker) Learn(sig []byte, positions []int) bool {
+	reached := true
+	for block := 0; block < w.params.Len; block++ {
+		value := sig[block*w.params.N : (block+1)*w.params.N]
+		if positions[block] >= w.lowest[block] {
+			reached = reached && bytes.Equal(w.values[block][positions[block]], value)
+			continue
+		}
+		reached = w.extend(block, value, positions[block]) && reached
+	}
+	return reached
+}
+
+// Position finds how many times the secret key of a chain has been hashed to give value, or -1 if value isn't on the
+// chain
+func (w *ChainWalker) Position(block int, value []byte) int {
+	for position := w.lowest[block]; position < w.params.W; position++ {
+		if bytes.Equal(w.values[block][position], value) {
+			return position
+		}
+	}
+	if w.offChain[block][string(value)] {
+		return -1
+	}
+	// the closest candidates take the fewest F calls to reach the known chain
+	for position := w.lowest[block] - 1; position >= 0; position-- {
+		if w.extend(block, value, position) {
+			return position
+		}
+	}
+	w.offChain[block][string(value)] = true
+	return -1
+}
+
+// Positions finds the position of every block of the WOTS signature sig, with -1 for blocks not on their chain
+func (w *ChainWalker) Positions(sig []byte) []int {
+	positions := make([]int, w.params.Len)
+	for block := 0; block < w.params.Len; block++ {
+		positions[block] = w.Position(block, sig[block*w.params.N:(block+1)*w.params.N])
+	}
+	return positions
+}
+
+// BatchPositions finds the positions of the blocks of many WOTS signatures by the walker's key. Every value stepped
+// through is kept, so each signature is mostly compared against the chains walked for the ones before it
+func (w *ChainWalker) BatchPositions(sigs [][]byte) [][]int {
+	positions := make([][]int, len(sigs))
+	for i, sig := range sigs {
+		positions[i] = w.Positions(sig)
+	}
+	return positions
+}
+
+// extend steps value forward from position one F call at a time until the lowest known position. If it reaches the
+// known value there, every value on the way is kept and the lowest position moves down to position
+func (w *ChainWalker) extend(block int, value []byte, position int) bool {
+	adrs := w.Key.Address()
+	adrs.SetChainAddress(block)
+
+	lowest := w.lowest[block]
+	walked := make([][]byte, lowest-position)
+	tmp := append([]byte(nil), value...)
+	for p := position; p < lowest; p++ {
+		walked[p-position] = tmp
+		adrs.SetHashAddress(p)
+		tmp = w.params.Tweak.F(w.PKseed, adrs, tmp)
+	}
+	if !bytes.Equal(tmp, w.values[block][lowest]) {
+		return false
+	}
+	copy(w.values[block][position:lowest], walked)
+	w.lowest[block] = position
+	return true
+}
@@ -0,0 +1,198 @@
+package attack
+
+import (
+	"bytes"
+	"io"
+	"math"
+
+	"github.com/kasperdi/SPHINCSPLUS-golang/address"
+	"github.com/kasperdi/SPHINCSPLUS-golang/hypertree"
+	"github.com/kasperdi/SPHINCSPLUS-golang/parameters"
+	"github.com/kasperdi/SPHINCSPLUS-golang/sphincs"
+	"github.com/kasperdi/SPHINCSPLUS-golang/util"
+	"github.com/kasperdi/SPHINCSPLUS-golang/wots"
+)
+
+// WOTSKey identifies a single WOTS key pair in the hypertree
+type WOTSKey struct {
+	Layer int
+	Tree  uint64
+	Leaf  int
+}
+
+// Address returns the ADRS of the WOTS key pair, ready for chain and hash addresses to be set
+func (key WOTSKey) Address() *address.ADRS {
+	adrs := new(address.ADRS)
+	adrs.SetLayerAddress(key.Layer)
+	adrs.SetTreeAddress(key.Tree)
+	adrs.SetKeyPairAddress(key.Leaf)
+	return adrs
+}
+
+// NumberOfWOTSKeys returns how many WOTS key pairs exist in the given layer of the hypertree, or math.MaxUint64 if
+// there are at least that many
+func NumberOfWOTSKeys(params *parameters.Parameters, layer int) uint64 {
+	bits := (params.D - layer) * params.Hprime
+	if bits >= 64 {
+		return math.MaxUint64
+	}
+	return 1 << bits
+}
+
+// KeyFromMsg finds the WOTS key pair used in the given layer when signing M with randomizer R
+func KeyFromMsg(params *parameters.Parameters, R []byte, PK *sphincs.SPHINCS_PK, M []byte, layer int) WOTSKey {
+	_, idxTree, idxLeaf := Digest(params, R, PK, M)
+	return KeyFromIdx(params, idxTree, idxLeaf, layer)
+}
+
+// KeyFromIdx walks up the hypertree from the bottom tree and leaf indices until the given layer is reached
+func KeyFromIdx(params *parameters.Parameters, idxTree uint64, idxLeaf int, layer int) WOTSKey {
+	for j := 1; j <= layer; j++ {
+		idxLeaf = int(idxTree % (1 << uint64(params.Hprime)))
+		idxTree = idxTree >> params.Hprime
+	}
+	return WOTSKey{Layer: layer, Tree: idxTree, Leaf: idxLeaf}
+}
+
+// Digest computes the FORS message and hypertree indices used when signing M with randomizer R
+func Digest(params *parameters.Parameters, R []byte, PK *sphincs.SPHINCS_PK, M []byte) ([]byte, uint64, int) {
+	// compute message digest and index
+	digest := params.Tweak.Hmsg(R, PK.PKseed, PK.PKroot, M)
+
+	tmpMdBytes := int(math.Floor(float64(params.K*params.A+7) / 8))
+	tmpIdxTreeBytes := int(math.Floor(float64(params.H-params.H/params.D+7) / 8))
+	tmpIdxLeafBytes := int(math.Floor(float64(params.H/params.D+7)) / 8)
+	tmpMd := digest[:tmpMdBytes]
+	tmpIdxTree := digest[tmpMdBytes:(tmpMdBytes + tmpIdxTreeBytes)]
+	tmpIdxLeaf := digest[(tmpMdBytes + tmpIdxTreeBytes):(tmpMdBytes + tmpIdxTreeBytes + tmpIdxLeafBytes)]
+
+	idxTree := uint64(util.BytesToUint64(tmpIdxTree) & (math.MaxUint64 >> (64 - (params.H - params.H/params.D))))
+	idxLeaf := int(util.BytesToUint32(tmpIdxLeaf) & (math.MaxUint32 >> (32 - params.H/params.D)))
+
+	return tmpMd, idxTree, idxLeaf
+}
+
+// MsgToBaseW converts a message signed by WOTS to its blocks, including the checksum. Each block is the number of
+// times the secret key of its chain is hashed in the signature
+func MsgToBaseW(params *parameters.Parameters, message []byte) []int {
+	msg := util.Base_w(message, params.W, params.Len1)
+
+	// compute checksum
+	csum := 0
+	for i := 0; i < params.Len1; i++ {
+		csum = csum + params.W - 1 - msg[i]
+	}
+
+	csum = csum << (8 - ((params.Len2 * int(math.Log2(float64(params.W)))) % 8))
+	len2Bytes := int(math.Ceil((float64(params.Len2) * math.Log2(float64(params.W))) / 8))
+	msg = append(msg, util.Base_w(util.ToByte(uint64(csum), len2Bytes), params.W, params.Len2)...)
+	return msg
+}
+
+// ChainPositions finds how many times each block of sig has been hashed by chaining it up to pk. Blocks which never
+// reach pk, e.g. because a fault knocked them off their hash chain, are set to -1. Use a ChainWalker to find the
+// positions of many signatures by the same key
+func ChainPositions(params *parameters.Parameters, sig []byte, pk []byte, PKseed []byte, key WOTSKey) []int {
+	return NewChainWalker(params, PKseed, key, pk).Positions(sig)
+}
+
+// MessageFromSignature finds the message blocks signed by sig, returning false if any block doesn't reach pk
+func MessageFromSignature(params *parameters.Parameters, sig []byte, pk []byte, PKseed []byte, key WOTSKey) (bool, []int) {
+	m := ChainPositions(params, sig, pk, PKseed, key)
+	for i := 0; i < params.Len; i++ {
+		if m[i] == -1 {
+			return false, nil
+		}
+	}
+	return true, m
+}
+
+// WOTSPKFromSignature finds the WOTS public key from a signature of message, as when verifying
+func WOTSPKFromSignature(params *parameters.Parameters, signature []byte, message []byte, PKseed []byte, key WOTSKey) []byte {
+	adrs := key.Address()
+
+	// convert message to base w
+	msg := MsgToBaseW(params, message)
+
+	sig := make([]byte, params.Len*params.N)
+
+	for i := 0; i < params.Len; i++ {
+		adrs.SetChainAddress(i)
+		adrs.SetHashAddress(0)
+		copy(sig[i*params.N:], wots.Chain(params, signature[i*params.N:(i+1)*params.N], msg[i], params.W-1-msg[i], PKseed, adrs))
+	}
+
+	return sig
+}
+
+// ForgeOTSignature hashes each of the shortest hash chains further until it signs the given message blocks, which
+// must all be at least as large as hashCount
+func ForgeOTSignature(params *parameters.Parameters, hashCount, messageBlocks []int, shortestHashChains, PKseed []byte, key WOTSKey) []byte {
+	adrs := key.Address()
+	newSig := make([]byte, params.Len*params.N)
+
+	for i := 0; i < params.Len; i++ {
+		adrs.SetChainAddress(i)
+		adrs.SetHashAddress(0)
+		copy(newSig[i*params.N:], wots.Chain(params, shortestHashChains[i*params.N:(i+1)*params.N], hashCount[i], messageBlocks[i]-hashCount[i], PKseed, adrs))
+	}
+
+	return newSig
+}
+
+// GraftSignature replaces the target layer of forgedSignature with the forged WOTS signature, and every layer
+// above it with the victim's valid signature through the same WOTS key
+func GraftSignature(forgedSignature *sphincs.SPHINCS_SIG, validSignature *hypertree.HTSignature, layer int, fWotsSig []byte) {
+	forgedSignature.SIG_HT.XMSSSignatures[layer].WotsSignature = fWotsSig
+	forgedSignature.SIG_HT.XMSSSignatures[layer].AUTH = validSignature.XMSSSignatures[layer].AUTH
+	for j := layer + 1; j < len(validSignature.XMSSSignatures); j++ {
+		forgedSignature.SIG_HT.XMSSSignatures[j] = validSignature.XMSSSignatures[j]
+	}
+}
+
+// CheckBlocksSignable returns true if every block of the message is hashed at least as many times as the shortest chain
+func CheckBlocksSignable(params *parameters.Parameters, messageBlocks []int, hashCount []int) bool {
+	for i := 0; i < params.Len; i++ {
+		if messageBlocks[i] < hashCount[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// SignableFraction estimates the fraction of WOTS messages which can be signed with the given shortest chains
+func SignableFraction(params *parameters.Parameters, hashCount []int, rng io.Reader) float64 {
+	signable := 0
+	samples := 1000
+	for i := 0; i < samples; i++ {
+		if CheckBlocksSignable(params, MsgToBaseW(params, RandomBytes(rng, params.N)), hashCount) {
+			signable += 1
+		}
+	}
+	return float64(signable) / float64(samples)
+}
+
+// RandomBytes reads n bytes from rng
+func RandomBytes(rng io.Reader, n int) []byte {
+	b := make([]byte, n)
+	if _, err := io.ReadFull(rng, b); err != nil {
+		panic(err)
+	}
+	return b
+}
+
+// LeaksChainValues returns true if a chain of the faulty WOTS signature in the given layer still reaches the WOTS pk,
+// but has been hashed fewer times than in the valid signature
+func LeaksChainValues(params *parameters.Parameters, message []byte, pk *sphincs.SPHINCS_PK,
+	validSignature *sphincs.SPHINCS_SIG, faultySignature *sphincs.SPHINCS_SIG, layer int) bool {
+
+	state, err := NewChainState(params, pk, message, validSignature, layer)
+	if err != nil {
+		return false
+	}
+	faultyWotsSig := faultySignature.SIG_HT.GetXMSSSignature(layer).WotsSignature
+	if bytes.Equal(faultyWotsSig, state.Signature) {
+		return false
+	}
+	return state.Update(params, pk.PKseed, faultyWotsSig)
+}
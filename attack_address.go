@@ -0,0 +1,123 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/kasperdi/SPHINCSPLUS-golang/attack"
+	"github.com/kasperdi/SPHINCSPLUS-golang/hypertree"
+	"github.com/kasperdi/SPHINCSPLUS-golang/parameters"
+	"github.com/kasperdi/SPHINCSPLUS-golang/sphincs"
+	"github.com/kasperdi/SPHINCSPLUS-golang/util"
+	mathrand "math/rand"
+	"os"
+)
+
+// addressFaultResults counts what happened to the faulty signatures of one ADRS word and fault mode
+type addressFaultResults struct {
+	trials    int
+	unchanged int // the fault didn't change the signature
+	verified  int // the faulty signature still verifies
+	leaked    int // a WOTS chain of the faulted layer is lower down than in the valid signature
+	graftable int // the layer above signed a different root with the same WOTS key
+}
+
+// addressFaults corrupts each ADRS word while signing a layer, and reports how exploitable the signatures are
+func addressFaults(args []string) {
+	// sphincs+ parameters
+	params := parameters.MakeSphincsPlusSHA256256fRobust(true)
+
+	flags := flag.NewFlagSet("addressFaults", flag.ExitOnError)
+	faultLayer := flags.Int("layer", params.D-2, "hypertree layer signed with a corrupted ADRS")
+	trials := flags.Int("trials", 10, "faulty signatures per ADRS word and fault mode")
+	seedHex := flags.String("seed", "", "hex seed for all randomness used in the run (random if not given)")
+	if err := flags.Parse(args); err != nil {
+		panic(err)
+	}
+	if *faultLayer < 0 || *faultLayer > params.D-1 {
+		fmt.Printf("layer must be between 0 and %d\n", params.D-1)
+		os.Exit(1)
+	}
+	if *trials < 1 {
+		fmt.Println("trials must be at least 1")
+		os.Exit(1)
+	}
+	rng := util.NewDRBG(parseSeed(*seedHex))
+
+	sk, pk := sphincs.Spx_keygen_rng(params, rng)
+	faultRand := mathrand.New(util.NewDRBG(rng.Bytes(32)))
+	authCalls := xmssAuthCalls(params)
+
+	fmt.Printf("Corrupting ADRS words while signing layer %d\n", *faultLayer)
+	fmt.Printf("%-8s %-5s %9s %9s %9s %9s %9s\n", "word", "calls", "trials", "unchanged", "verified", "leaked", "graftable")
+	words := []string{hypertree.LayerWord, hypertree.TreeWord, hypertree.KeyPairWord, hypertree.ChainWord, hypertree.HashWord}
+	for _, word := range words {
+		for _, mode := range []string{"auth", "wots", "all"} {
+			results := new(addressFaultResults)
+			for i := 0; i < *trials; i++ {
+				// sign with the same randomness so the valid and faulty signatures use the same WOTS keys
+				message := rng.Bytes(params.N)
+				signSeed := rng.Bytes(32)
+				validSignature := sphincs.Spx_sign_rng(params, message, sk, util.NewDRBG(signSeed))
+
+				// a single call while computing AUTH or the WOTS signature, or every call of the layer
+				call := -1
+				switch mode {
+				case "auth":
+					call = faultRand.Intn(authCalls)
+				case "wots":
+					call = authCalls + faultRand.Intn(wotsSignCalls(params, message, pk, validSignature, *faultLayer))
+				}
+				faultModel := &hypertree.AddressFault{Word: word, Layer: *faultLayer, Call: call, Rand: faultRand}
+				faultySignature, report := sphincs.Spx_sign_fault_report(params, message, sk, faultModel, util.NewDRBG(signSeed))
+				results.add(params, message, pk, validSignature, faultySignature, report.Faulted(), *faultLayer)
+			}
+			fmt.Printf("%-8s %-5s %9d %9d %9d %9d %9d\n", word, mode, results.trials, results.unchanged, results.verified, results.leaked, results.graftable)
+		}
+	}
+}
+
+func (r *addressFaultResults) add(params *parameters.Parameters, message []byte, pk *sphincs.SPHINCS_PK,
+	validSignature *sphincs.SPHINCS_SIG, faultySignature *sphincs.SPHINCS_SIG, faulted bool, faultLayer int) {
+
+	r.trials += 1
+	if !faulted {
+		r.unchanged += 1
+		return
+	}
+	if sphincs.Spx_verify(params, message, faultySignature, pk) {
+		r.verified += 1
+	}
+	if attack.LeaksChainValues(params, message, pk, validSignature, faultySignature, faultLayer) {
+		r.leaked += 1
+	}
+	if faultLayer < params.D-1 {
+		// the grafting attack re-uses the key above if its chains reach the key's pk for a different message
+		if attack.LeaksChainValues(params, message, pk, validSignature, faultySignature, faultLayer+1) {
+			r.graftable += 1
+		}
+	}
+}
+
+// xmssAuthCalls is the number of tweakable hash calls taking an ADRS made by Xmss_sign while computing AUTH, before
+// the WOTS signature is computed
+func xmssAuthCalls(params *parameters.Parameters) int {
+	// every WOTS pk takes Len PRF, Len * (W-1) F and one T_l call
+	leaves := 1<<params.Hprime - 1
+	nodes := 1<<params.Hprime - 1 - params.Hprime
+	return leaves*(params.Len*params.W+1) + nodes
+}
+
+// wotsSignCalls is the number of tweakable hash calls taking an ADRS made by Xmss_sign while computing the WOTS
+// signature of faultLayer in signature, which depends on the message it signs
+func wotsSignCalls(params *parameters.Parameters, message []byte, pk *sphincs.SPHINCS_PK, signature *sphincs.SPHINCS_SIG, faultLayer int) int {
+	state, err := attack.NewChainState(params, pk, message, signature, faultLayer)
+	if err != nil {
+		panic(err)
+	}
+	// every chain takes one PRF call for its secret key and one F call for every time it is hashed
+	calls := params.Len
+	for _, hashCount := range state.HashCount {
+		calls += hashCount
+	}
+	return calls
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/kasperdi/SPHINCSPLUS-golang/attack"
+	"github.com/kasperdi/SPHINCSPLUS-golang/parameters"
+	"github.com/kasperdi/SPHINCSPLUS-golang/sphincs"
+	"github.com/kasperdi/SPHINCSPLUS-golang/util"
+	mathrand "math/rand"
+	"os"
+)
+
+// forsLeak faults the FORS signature of a single FORS key pair, harvests the secret leaves it leaks and forges a
+// FORS signature for a new FORS message under the victim's key
+func forsLeak(args []string) {
+	// deterministic signing, so signing the same message always uses the same FORS key pair
+	params := parameters.MakeSphincsPlusSHA256256fRobust(false)
+
+	flags := flag.NewFlagSet("forsLeak", flag.ExitOnError)
+	target := flags.String("target", sphincs.IndicesTarget, "part of the FORS signature to fault: indices or treepkauth")
+	faults := flags.Int("faults", 200, "number of faulty signatures to harvest")
+	bits := flags.Int("bits", 1, "number of bits flipped by each fault")
+	seedHex := flags.String("seed", "", "hex seed for all randomness used in the run (random if not given)")
+	if err := flags.Parse(args); err != nil {
+		panic(err)
+	}
+	if *target != sphincs.IndicesTarget && *target != sphincs.TreePKAUTHTarget {
+		fmt.Printf("unknown FORS fault target %s\n", *target)
+		os.Exit(1)
+	}
+	if *faults < 1 || *bits < 1 {
+		fmt.Println("faults and bits must be at least 1")
+		os.Exit(1)
+	}
+	rng := util.NewDRBG(parseSeed(*seedHex))
+
+	oracleRng := util.NewDRBG(rng.Bytes(32))
+	faultModel := &sphincs.ForsFault{Target: *target, Bits: *bits, Rand: mathrand.New(util.NewDRBG(rng.Bytes(32)))}
+	oracle := createSigningOracle(params, faultModel, 1, nil, 0, oracleRng)
+	pk := oracle.PublicKey()
+
+	// sign correctly
+	message := rng.Bytes(params.N)
+	goodSignature := querySign(oracle, message)
+
+	leaves := attack.NewForsLeaves(params, pk, message, goodSignature)
+	_, idxTree, idxLeaf := attack.Digest(params, goodSignature.R, pk, message)
+	fmt.Printf("Attacking FORS key pair %d of tree %d\n", idxLeaf, idxTree)
+
+	for f := 1; f <= *faults; f++ {
+		// sign the same message but cause a fault
+		badSignature := querySignFaulty(oracle, message)
+		for _, i := range leaves.Harvest(badSignature.SIG_FORS) {
+			fmt.Printf("Faulty signature %d leaked leaf of FORS tree %d, %d leaves known\n", f, i, len(leaves.Leaves[i]))
+		}
+	}
+
+	closeOracle(oracle)
+	oracle.faults.printForsSummary()
+
+	// chance that the FORS message of a new signature by this key pair only uses known leaves
+	fmt.Printf("Probability a random FORS message can be signed with the known leaves: %g\n", leaves.SignableFraction())
+
+	forgedMd, forgedSignature := leaves.Forge()
+	if forgedSignature == nil {
+		fmt.Println("No extra leaves were leaked, can't forge :(")
+		return
+	}
+	if leaves.Verify(forgedMd, forgedSignature) {
+		fmt.Printf("Forged FORS signature for new FORS message %x\n", forgedMd)
+	} else {
+		fmt.Println("Forged FORS signature didn't verify :(")
+	}
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/kasperdi/SPHINCSPLUS-golang/attack"
+	"github.com/kasperdi/SPHINCSPLUS-golang/hypertree"
+	"github.com/kasperdi/SPHINCSPLUS-golang/parameters"
+	"github.com/kasperdi/SPHINCSPLUS-golang/sphincs"
+	"github.com/kasperdi/SPHINCSPLUS-golang/util"
+	mathrand "math/rand"
+	"os"
+	"strings"
+)
+
+// forsGraft faults the FORS public key signed by layer 0 with deterministic signing, so every faulty signature of the
+// same message leaks chain values of the same layer 0 WOTS key. A forgery grafts an attacker FORS key under the
+// victim's layer 0 leaf, which needs a randomizer whose message digest selects that leaf. Its cost is compared with
+// the parallel attack on the top layer
+func forsGraft(args []string) {
+	flags := flag.NewFlagSet("forsGraft", flag.ExitOnError)
+	paramsName := flags.String("params", defaultParameterSet, "parameter set, or toy for a 12 bit hypertree")
+	faults := flags.Int("faults", 200, "number of faulty signatures")
+	bits := flags.Int("bits", 64, "number of bits flipped in the FORS public key by each fault")
+	maxSearchBits := flags.Int("maxSearchBits", 24, "only search for a randomizer selecting the leaf if the hypertree has at most this many bits")
+	attempts := flags.Int("attempts", 100, "forgery attempts")
+	seedHex := flags.String("seed", "", "hex seed for all randomness used in the run (random if not given)")
+	if err := flags.Parse(args); err != nil {
+		panic(err)
+	}
+
+	// deterministic signing, so signing the same message always uses the same layer 0 WOTS key
+	var params *parameters.Parameters
+	if strings.ToLower(*paramsName) == "toy" {
+		params = parameters.MakeSphincsPlusToy(false)
+	} else {
+		params = parseParameterSet(*paramsName, false)
+	}
+	if *faults < 1 || *bits < 1 || *attempts < 1 {
+		fmt.Println("faults, bits and attempts must be at least 1")
+		os.Exit(1)
+	}
+	rng := util.NewDRBG(parseSeed(*seedHex))
+
+	oracleRng := util.NewDRBG(rng.Bytes(32))
+	faultModel := &sphincs.ForsFault{Target: sphincs.PKForsTarget, Bits: *bits, Rand: mathrand.New(util.NewDRBG(rng.Bytes(32)))}
+	oracle := createSigningOracle(params, faultModel, 1, nil, 0, oracleRng)
+	pk := oracle.PublicKey()
+
+	// sign correctly
+	message := rng.Bytes(params.N)
+	goodSignature := querySign(oracle, message)
+
+	state, err := attack.NewChainState(params, pk, message, goodSignature, 0)
+	if err != nil {
+		panic("Good signature didn't sign :(")
+	}
+	fmt.Printf("Attacking layer 0 WOTS key %d of tree %d\n", state.Key.Leaf, state.Key.Tree)
+
+	for f := 1; f <= *faults; f++ {
+		// sign the same message but fault the FORS public key
+		badSignature := querySignFaulty(oracle, message)
+		if state.Update(params, pk.PKseed, badSignature.SIG_HT.GetXMSSSignature(0).WotsSignature) {
+			fmt.Printf("Faulty signature %d gave shorter hash chains\n", f)
+		}
+	}
+	closeOracle(oracle)
+
+	// the current attack on the top layer, run against the same key pair with as many faulty signatures
+	fmt.Printf("Running the parallel attack on the top layer with %d faulty signatures\n", *faults)
+	topLayer := topLayerAttack(params, oracle.sk, pk, *faults, util.NewDRBG(rng.Bytes(32)))
+
+	layer0Signable := attack.SignableFraction(params, state.HashCount, rng)
+	topLayerSignable := 0.0
+	for _, keyState := range topLayer.States {
+		topLayerSignable += attack.SignableFraction(params, keyState.HashCount, rng) / float64(len(topLayer.States))
+	}
+	fmt.Printf("Layer 0: %d faulty signatures on one WOTS key, %.4f of messages signable, 2^%d message digests searched once and 1 FORS key pair per attempt\n",
+		*faults, layer0Signable, params.H)
+	fmt.Printf("Top layer (parallel attack): %d faulty signatures over %d WOTS keys, %.4f of messages signable on average, 1 signature per attempt\n",
+		*faults, len(topLayer.States), topLayerSignable)
+	if layer0Signable == 0 || topLayerSignable == 0 {
+		fmt.Println("Expected forgery cost: no messages signable through at least one of the layers yet")
+	} else {
+		fmt.Printf("Expected forgery cost: layer 0 2^%d message digests and %.1f FORS key pairs, top layer %.1f signatures\n",
+			params.H, 1/layer0Signable, 1/topLayerSignable)
+	}
+
+	if params.H > *maxSearchBits {
+		fmt.Printf("Not searching 2^%d message digests for a randomizer selecting the layer 0 leaf\n", params.H)
+		return
+	}
+
+	forgedMessage := rng.Bytes(params.N)
+	_, tries, err := attack.NewForsGrafter(params, pk, state, rng).Forge(forgedMessage, *attempts)
+	switch err {
+	case nil:
+		fmt.Printf("Forged signature with an attacker FORS key after %d attempts!!!!\n", tries)
+	case attack.ErrNoForgery:
+		fmt.Printf("Couldn't forge in %d attempts :(\n", *attempts)
+	default:
+		fmt.Println("Failed to forge when should have been successful")
+	}
+}
+
+// topLayerAttack runs the parallel attack on the top layer against the key pair sk, collecting faults faulty
+// signatures of layer D-2 bit flips. Signing is deterministic, so every query signs a distinct message to reach every
+// WOTS key of the top layer
+func topLayerAttack(params *parameters.Parameters, sk *sphincs.SPHINCS_SK, pk *sphincs.SPHINCS_PK, faults int, rng *util.DRBG) *attack.Collector {
+	faultModel := &hypertree.BitFlipFault{MaxBits: 64, Layer: params.D - 2, Rand: mathrand.New(util.NewDRBG(rng.Bytes(32)))}
+	// the attacker doesn't need the secret hash chains printed, so no layer is debugged
+	oracle := newSimulatedOracle(params, sk, pk, faultModel, 1, nil, -1, util.NewDRBG(rng.Bytes(32)))
+	messages := attack.NewDistinctMessageSource(rng.Bytes(params.N), rng.Bytes(32))
+	collector := attack.NewCollector(params, pk, nil, []int{params.D - 1})
+	for collector.Remaining() > 0 {
+		message := messages.Next()
+		if _, err := collector.AddValidMessage(message, querySign(oracle, message)); err != nil {
+			panic("Good signature didn't sign :(")
+		}
+	}
+	for f := 0; f < faults; f++ {
+		message := messages.Next()
+		collector.AddFaultyMessage(message, querySignFaulty(oracle, message))
+	}
+	closeOracle(oracle)
+	return collector
+}
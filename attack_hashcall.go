@@ -0,0 +1,123 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/kasperdi/SPHINCSPLUS-golang/address"
+	"github.com/kasperdi/SPHINCSPLUS-golang/attack"
+	"github.com/kasperdi/SPHINCSPLUS-golang/parameters"
+	"github.com/kasperdi/SPHINCSPLUS-golang/sphincs"
+	"github.com/kasperdi/SPHINCSPLUS-golang/tweakable"
+	"github.com/kasperdi/SPHINCSPLUS-golang/util"
+	mathrand "math/rand"
+	"os"
+	"reflect"
+)
+
+// hashCallFaults glitches the output of a single tweakable hash call while signing, chosen by its position in the
+// signing timeline, and reports how exploitable each faulty signature is
+func hashCallFaults(args []string) {
+	// sphincs+ parameters
+	params := parameters.MakeSphincsPlusSHA256256fRobust(true)
+
+	flags := flag.NewFlagSet("hashCallFaults", flag.ExitOnError)
+	function := flags.String("function", "", "only glitch calls to this function: Hmsg, PRF, PRFmsg, F, H or T_l (default any)")
+	layer := flags.Int("layer", -1, "only glitch calls with this layer address, which FORS shares with layer 0 (default any)")
+	call := flags.Int("call", -1, "index of the glitched call among the selected calls (default random)")
+	trials := flags.Int("trials", 20, "faulty signatures to create")
+	seedHex := flags.String("seed", "", "hex seed for all randomness used in the run (random if not given)")
+	if err := flags.Parse(args); err != nil {
+		panic(err)
+	}
+	switch *function {
+	case "", tweakable.HmsgCall, tweakable.PRFCall, tweakable.PRFmsgCall, tweakable.FCall, tweakable.HCall, tweakable.T_lCall:
+	default:
+		fmt.Printf("unknown hash function %s\n", *function)
+		os.Exit(1)
+	}
+	if *layer < -1 || *layer > params.D-1 {
+		fmt.Printf("layer must be between 0 and %d\n", params.D-1)
+		os.Exit(1)
+	}
+	if *trials < 1 {
+		fmt.Println("trials must be at least 1")
+		os.Exit(1)
+	}
+	rng := util.NewDRBG(parseSeed(*seedHex))
+
+	sk, pk := sphincs.Spx_keygen_rng(params, rng)
+	faultRand := mathrand.New(util.NewDRBG(rng.Bytes(32)))
+	filter := func(name string, adrs *address.ADRS) bool {
+		if *function != "" && name != *function {
+			return false
+		}
+		return *layer == -1 || adrs != nil && adrs.GetLayerAddress() == *layer
+	}
+
+	unchanged, verified, leaked := 0, 0, 0
+	for i := 1; i <= *trials; i++ {
+		// sign with the same randomness so the valid and faulty signatures use the same WOTS keys
+		message := rng.Bytes(params.N)
+		signSeed := rng.Bytes(32)
+
+		// a correct signature gives the timeline of the calls which can be glitched
+		counter := &tweakable.CallFaultTweak{Tweak: params.Tweak, Filter: filter}
+		validSignature := sphincs.Spx_sign_rng(tweakParams(params, counter), message, sk, util.NewDRBG(signSeed))
+		if i == 1 {
+			fmt.Printf("Signing makes %d hash calls, %d of which can be glitched: %v\n", counter.Total(), counter.Selected, counter.Calls)
+		}
+		if counter.Selected == 0 {
+			fmt.Println("no hash calls match the given function and layer")
+			os.Exit(1)
+		}
+		glitchedCall := *call
+		if glitchedCall < 0 {
+			glitchedCall = faultRand.Intn(counter.Selected)
+		} else if glitchedCall >= counter.Selected {
+			fmt.Printf("call must be less than %d\n", counter.Selected)
+			os.Exit(1)
+		}
+
+		// flip a single bit of the output of the glitched call
+		description := ""
+		glitch := &tweakable.CallFaultTweak{Tweak: params.Tweak, Filter: filter, Call: glitchedCall,
+			Corrupt: func(name string, adrs *address.ADRS, output []byte) {
+				description = name
+				if adrs != nil {
+					description = fmt.Sprintf("%s layer %d type %d", name, adrs.GetLayerAddress(), adrs.GetType())
+				}
+				bit := faultRand.Intn(8 * len(output))
+				output[bit>>3] ^= 1 << (bit % 8)
+			}}
+		faultySignature := sphincs.Spx_sign_rng(tweakParams(params, glitch), message, sk, util.NewDRBG(signSeed))
+
+		if reflect.DeepEqual(validSignature, faultySignature) {
+			unchanged += 1
+			fmt.Printf("Call %d (%s): signature unchanged\n", glitchedCall, description)
+			continue
+		}
+		valid := sphincs.Spx_verify(params, message, faultySignature, pk)
+		if valid {
+			verified += 1
+		}
+		leakingLayers := make([]int, 0)
+		for j := 0; j < params.D; j++ {
+			if !reflect.DeepEqual(validSignature.SIG_HT.GetXMSSSignature(j), faultySignature.SIG_HT.GetXMSSSignature(j)) &&
+				attack.LeaksChainValues(params, message, pk, validSignature, faultySignature, j) {
+				leakingLayers = append(leakingLayers, j)
+			}
+		}
+		if len(leakingLayers) > 0 {
+			leaked += 1
+		}
+		fmt.Printf("Call %d (%s): verified %t, leaked chain values in layers %v\n", glitchedCall, description, valid, leakingLayers)
+	}
+	fmt.Printf("%d trials: %d unchanged, %d verified, %d leaked chain values\n", *trials, unchanged, verified, leaked)
+}
+
+// tweakParams returns a copy of params hashing with tweak
+func tweakParams(params *parameters.Parameters, tweak tweakable.TweakableHashFunction) *parameters.Parameters {
+	faultyParams := *params
+	faultyParams.Tweak = tweak
+	return &faultyParams
+}
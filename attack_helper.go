@@ -2,152 +2,246 @@ package main
 
 import (
 	"bufio"
-	"bytes"
 	"fmt"
 	"github.com/fatih/color"
-	"github.com/kasperdi/SPHINCSPLUS-golang/address"
-	"github.com/kasperdi/SPHINCSPLUS-golang/parameters"
+	"github.com/kasperdi/SPHINCSPLUS-golang/attack"
+	"github.com/kasperdi/SPHINCSPLUS-golang/hypertree"
 	"github.com/kasperdi/SPHINCSPLUS-golang/sphincs"
 	"github.com/kasperdi/SPHINCSPLUS-golang/util"
-	"github.com/kasperdi/SPHINCSPLUS-golang/wots"
-	"math"
+	mathrand "math/rand"
 	"os"
+	"path/filepath"
+	"strings"
+	"sync"
 )
 
-func getWOTSMessageFromSignatureAndPK(sig []byte, pk []byte, params *parameters.Parameters, PKseed []byte, idxLeaf int) (bool, []int) {
-	// repeated hashes on sig should be equal to publicKey
-	// number of hashes correspond to m (inc checksum)
-	m := make([]int, 0)
-	adrs := new(address.ADRS)
-	adrs.SetLayerAddress(16) // target layer in the tree
-	adrs.SetKeyPairAddress(idxLeaf)
-
-	for i := 0; i < params.Len; i++ {
-		for c := 0; c < params.W; c++ {
-			adrs.SetChainAddress(i)
-			adrs.SetHashAddress(0)
-			hashed := wots.Chain(params, sig[i*params.N:(i+1)*params.N], params.W-1-c, c, PKseed, adrs)
-			if bytes.Equal(hashed, pk[i*params.N:(i+1)*params.N]) {
-				m = append(m, params.W-c-1)
-				break
-			}
-			if c == params.W-1 {
-				return false, nil
-			}
-		}
+// printFaultyResult prints the layers identified as faulted in a faulty signature and the new shortest hash chains
+func printFaultyResult(collector *attack.Collector, result *attack.FaultyResult) {
+	for _, key := range result.Derived {
+		fmt.Printf("Derived message and public key of layer %d WOTS key %d of tree %d\n", key.Layer, key.Leaf, key.Tree)
+	}
+	if len(result.Derived) > 0 {
+		return
+	}
+	if len(result.FaultedLayers) == 0 {
+		fmt.Println("Faulty signature wasn't faulted in any target layer")
+		return
+	}
+	if len(result.Shorter) == 0 {
+		fmt.Printf("Faulted layers %v: new non-smaller set of hash chains found\n", result.FaultedLayers)
+		return
+	}
+	for _, key := range result.Shorter {
+		fmt.Printf("Faulted layers %v: new shortest set of hash chains in layer %d: \n", result.FaultedLayers, key.Layer)
+		printIntArrayPadded(collector.States[key].HashCount)
 	}
-	return true, m
 }
 
-// Finds pk from signature, for verification
-func getWOTSPKFromMessageAndSignature(params *parameters.Parameters, signature []byte, message []byte, PKseed []byte, idxLeaf int) []byte {
-	adrs := new(address.ADRS)
-	adrs.SetLayerAddress(16) // target layer in the tree
-	adrs.SetKeyPairAddress(idxLeaf)
-
-	// convert message to base w
-	msg := msgToBaseW(params, message)
-
-	sig := make([]byte, params.Len*params.N)
+// forgeMessageSignature tries partial signatures of message until one can be forged, printing every attempt. It
+// gives up after maxAttempts, or never if maxAttempts is 0, returning the forgery and the attempts it took or -1
+func forgeMessageSignature(forger *attack.Forger, message []byte, maxAttempts int) (*sphincs.SPHINCS_SIG, int) {
+	for attempt := 1; maxAttempts == 0 || attempt <= maxAttempts; attempt++ {
+		result, err := forger.Attempt(message, forger.PartialSignature(message))
+		if err != nil {
+			fmt.Println("Failed to forge when should have been successful")
+			continue
+		}
+		if !result.Signable {
+			fmt.Println("Message was not signable with our recovered shortest hash chain length :(")
+			printHashCountVsMessageBlocks(result.MessageBlocks, result.HashCount)
+			continue
+		}
 
-	for i := 0; i < params.Len; i++ {
-		adrs.SetChainAddress(i)
-		adrs.SetHashAddress(0)
-		copy(sig[i*params.N:], wots.Chain(params, signature[i*params.N:(i+1)*params.N], msg[i], params.W-1-msg[i], PKseed, adrs))
+		fmt.Printf("Forged signature through layer %d with required chain lengths:\n", result.Key.Layer)
+		printIntArrayPadded(result.MessageBlocks)
+		fmt.Println("Each of which is greater than or equal to the shortest chain lengths:")
+		printIntArrayPadded(result.HashCount)
+		fmt.Println("Forged signature!!!!")
+		return result.Signature, attempt
 	}
-
-	return sig
+	return nil, -1
 }
 
-func msgToBaseW(params *parameters.Parameters, message []byte) []int {
-	msg := util.Base_w(message, params.W, params.Len1)
-
-	// compute checksum
-	csum := 0
-	for i := 0; i < params.Len1; i++ {
-		csum = csum + params.W - 1 - msg[i]
+// newMessageSource creates the message source selected by opts for the attacked message, whose distinct messages
+// are derived from seed alone
+func newMessageSource(opts *attackOptions, message []byte, seed []byte) *attack.MessageSource {
+	if !opts.distinct {
+		return attack.NewMessageSource(message)
+	}
+	// a resumed attack signs new messages rather than those of its earlier sessions
+	if opts.session > 0 {
+		seed = append([]byte(fmt.Sprintf("messages session %d", opts.session)), opts.seed...)
 	}
+	return attack.NewDistinctMessageSource(message, seed)
+}
 
-	csum = csum << (8 - ((params.Len2 * int(math.Log2(float64(params.W)))) % 8))
-	len2Bytes := int(math.Ceil((float64(params.Len2) * math.Log2(float64(params.W))) / 8))
-	msg = append(msg, util.Base_w(util.ToByte(uint64(csum), len2Bytes), params.W, params.Len2)...)
-	return msg
+// createSeededSigningOracle creates a signing oracle faulting opts.faultLayer, with its key, signatures and faults all
+// derived from rng. If opts.oracle or opts.replay is given it connects to that oracle or replays that transcript
+// instead, whose ground truth isn't known, so the returned fault log is nil. Queries are recorded to opts.transcript
+func createSeededSigningOracle(opts *attackOptions, rng *util.DRBG) (attack.SigningOracle, *faultLog) {
+	var oracle attack.SigningOracle
+	var faultTruth *faultLog
+	switch {
+	case opts.replay != "":
+		oracle = replaySigningOracle(opts)
+	case opts.oracle != "":
+		oracle = dialSigningOracle(opts)
+	default:
+		simulated := createSimulatedOracle(opts, rng)
+		oracle, faultTruth = simulated, simulated.faults
+	}
+	if opts.transcript != "" {
+		oracle = recordSigningOracle(opts, oracle)
+	}
+	return oracle, faultTruth
 }
 
-func getLastTreeIdxFromMsg(params *parameters.Parameters, R []byte, PK *sphincs.SPHINCS_PK, M []byte) uint64 {
-	idxTree := getTreeIdxFromMsg(params, R, PK, M)
+// createSimulatedOracle creates the in-process oracle of createSeededSigningOracle
+func createSimulatedOracle(opts *attackOptions, rng *util.DRBG) *simulatedOracle {
+	oracleRng := util.NewDRBG(rng.Bytes(32))
+	sk, pk := sphincs.Spx_keygen_rng(opts.params, oracleRng)
+	// a resumed attack keeps the key pair of its seed, but signs and faults with new randomness so it doesn't repeat
+	// the signatures already collected
+	if opts.session > 0 {
+		rng = sessionRng(opts, "oracle")
+		oracleRng = util.NewDRBG(rng.Bytes(32))
+	}
+	faultModel := newFaultModel(opts, mathrand.New(util.NewDRBG(rng.Bytes(32))))
+	// only draw the occurrence source when faults can miss, so seeds from always faulting runs still reproduce
+	var occurrence *mathrand.Rand
+	if opts.probability < 1 {
+		occurrence = mathrand.New(util.NewDRBG(rng.Bytes(32)))
+	}
+	return newSimulatedOracle(opts.params, sk, pk, faultModel, opts.probability, occurrence, opts.targetLayer(), oracleRng)
+}
 
-	for j := 1; j < params.D-1; j++ {
-		idxTree = idxTree >> (params.H / params.D)
+// newFaultModel creates the fault model selected by opts, drawing its faults from faultRand
+func newFaultModel(opts *attackOptions, faultRand *mathrand.Rand) hypertree.FaultModel {
+	if len(opts.faultLayers) == 0 {
+		return newLayerFaultModel(opts, opts.faultLayer, faultRand)
 	}
-	return idxTree
+	faults := make([]hypertree.FaultModel, 0)
+	for _, layer := range opts.faultLayers {
+		faults = append(faults, newLayerFaultModel(opts, layer, faultRand))
+	}
+	return &hypertree.RandomLayerFault{Faults: faults, Weights: opts.layerWeights, Rand: faultRand}
 }
 
-func getTreeIdxFromMsg(params *parameters.Parameters, R []byte, PK *sphincs.SPHINCS_PK, M []byte) uint64 {
-	// compute message digest and index
-	digest := params.Tweak.Hmsg(R, PK.PKseed, PK.PKroot, M)
+// newLayerFaultModel creates the fault model selected by opts faulting layer
+func newLayerFaultModel(opts *attackOptions, layer int, faultRand *mathrand.Rand) hypertree.FaultModel {
+	switch opts.fault {
+	case chainSkipFault:
+		return &hypertree.ChainSkipFault{Skips: opts.skips, Layer: layer, Rand: faultRand}
+	case chainAbortFault:
+		return &hypertree.ChainSkipFault{Skips: opts.skips, Layer: layer, Abort: true, Rand: faultRand}
+	case rootFault:
+		return &hypertree.SubtreeRootFault{Height: opts.height, Layer: layer, Rand: faultRand}
+	default:
+		fault := &hypertree.BitFlipFault{MaxBits: 64, Layer: layer, Rand: faultRand}
+		if opts.magnitude != "" {
+			// already validated when parsing the flags
+			fault.Magnitude, _ = parseMagnitude(opts.magnitude)
+		}
+		return fault
+	}
+}
 
-	tmpMdBytes := int(math.Floor(float64(params.K*params.A+7) / 8))
-	tmpIdxTreeBytes := int(math.Floor(float64(params.H-params.H/params.D+7) / 8))
-	tmpIdxTree := digest[tmpMdBytes:(tmpMdBytes + tmpIdxTreeBytes)]
+// faultLog collects the ground truth of every faulty signature created by a signing oracle. It is for the
+// experimenter only and is never passed to the attack itself.
+type faultLog struct {
+	mutex   sync.Mutex
+	reports []*sphincs.FaultReport
+	// faulty signing queries where the fault didn't fire at all
+	missed int
+}
 
-	idxTree := uint64(util.BytesToUint64(tmpIdxTree) & (math.MaxUint64 >> (64 - (params.H - params.H/params.D))))
+func (l *faultLog) add(report *sphincs.FaultReport) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.reports = append(l.reports, report)
+}
 
-	return idxTree
+// miss records a faulty signing query where the fault didn't fire, signing correctly instead
+func (l *faultLog) miss(report *sphincs.FaultReport) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.missed += 1
+	l.reports = append(l.reports, report)
 }
 
-func forgeOTSignature(params *parameters.Parameters, hashCount, messageBlocks []int, minimalSignature, PKseed []byte, idxLeaf uint64) []byte {
-	adrs := new(address.ADRS)
-	adrs.SetLayerAddress(16) // target layer in the tree
-	adrs.SetKeyPairAddress(int(idxLeaf))
-	newSig := make([]byte, params.Len*params.N)
+// Reports returns the fault reports in the order the faulty signatures were created
+func (l *faultLog) Reports() []*sphincs.FaultReport {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	reports := make([]*sphincs.FaultReport, len(l.reports))
+	copy(reports, l.reports)
+	return reports
+}
 
-	for i := 0; i < params.Len; i++ {
-		adrs.SetChainAddress(i)
-		adrs.SetHashAddress(0)
-		copy(newSig[i*params.N:], wots.Chain(params, minimalSignature[i*params.N:(i+1)*params.N], hashCount[i], messageBlocks[i]-hashCount[i], PKseed, adrs))
+// effectiveRate returns the fraction of faulty signing queries which were actually changed in any of faultLayers
+func (l *faultLog) effectiveRate(faultLayers []int) float64 {
+	effective := 0
+	reports := l.Reports()
+	for _, report := range reports {
+		for _, layer := range faultLayers {
+			if report.Layer(layer) != nil {
+				effective += 1
+				break
+			}
+		}
 	}
-
-	return newSig
+	if len(reports) == 0 {
+		return 0
+	}
+	return float64(effective) / float64(len(reports))
 }
 
-func createSigningOracle(params *parameters.Parameters) (*sphincs.SPHINCS_PK, chan []byte, chan *sphincs.SPHINCS_SIG, chan []byte, chan *sphincs.SPHINCS_SIG) {
-	sk, pk := sphincs.Spx_keygen(params)
-	messageChan := make(chan []byte)
-	signatureChan := make(chan *sphincs.SPHINCS_SIG)
-
-	messageChanFault := make(chan []byte)
-	signatureChanFault := make(chan *sphincs.SPHINCS_SIG)
-
-	validSigns := 0
-	faultySigns := 0
-
-	go func() {
-		responding := true
-		for responding {
-			select {
-			case m := <-messageChan:
-				if m == nil {
-					responding = false
-					break
-				}
-				validSigns += 1
-				signatureChan <- sphincs.Spx_sign_debug(params, m, sk)
-			case m := <-messageChanFault:
-				if m == nil {
-					responding = false
-					break
-				}
-				faultySigns += 1
-				signatureChanFault <- sphincs.Spx_sign_fault(params, m, sk)
+// printSummary prints how many of the faulty signatures were actually changed by the fault in each of faultLayers
+func (l *faultLog) printSummary(faultLayers []int) {
+	reports := l.Reports()
+	l.mutex.Lock()
+	missed := l.missed
+	l.mutex.Unlock()
+	for _, faultLayer := range faultLayers {
+		effective, wots, auth, rootChanged := 0, 0, 0, 0
+		for _, report := range reports {
+			layerReport := report.Layer(faultLayer)
+			if layerReport == nil {
+				continue
+			}
+			effective += 1
+			if len(layerReport.WotsBits) > 0 {
+				wots += 1
+			}
+			if len(layerReport.AuthBits) > 0 {
+				auth += 1
+			}
+			if layerReport.RootChanged {
+				rootChanged += 1
 			}
 		}
-		fmt.Println("Oracle stopping")
-		fmt.Printf("Signed correctly: %d\n", validSigns)
-		fmt.Printf("Signed with fault: %d\n", faultySigns)
-	}()
+		fmt.Printf("[Truth] %d of %d faulty signatures were changed in layer %d\n", effective, len(reports), faultLayer)
+		fmt.Printf("[Truth] WOTS signature hit: %d, AUTH hit: %d, signed root changed: %d\n", wots, auth, rootChanged)
+	}
+	fmt.Printf("[Truth] fault fired in %d of %d queries, effective fault rate %.3f\n", len(reports)-missed, len(reports), l.effectiveRate(faultLayers))
+}
+
+// printForsSummary prints how many of the faulty signatures had their FORS signature changed
+func (l *faultLog) printForsSummary() {
+	effective, trees := 0, 0
+	reports := l.Reports()
+	for _, report := range reports {
+		if len(report.ForsTrees) > 0 {
+			effective += 1
+			trees += len(report.ForsTrees)
+		}
+	}
+	fmt.Printf("[Truth] %d of %d faulty signatures had their FORS signature changed, in %d trees\n", effective, len(reports), trees)
+}
 
-	return pk, messageChan, signatureChan, messageChanFault, signatureChanFault
+// nextSeed derives the seed of the next stats trial from the seed of the previous one
+func nextSeed(seed []byte) []byte {
+	return util.NewDRBG(append([]byte("next trial"), seed...)).Bytes(32)
 }
 
 func waitForUserInput() chan interface{} {
@@ -197,7 +291,48 @@ func printHashCountVsMessageBlocks(messageBlocks, hashCount []int) {
 
 }
 
+// statsFileName returns the results file for an attack, keeping results for non default faults separate. Results of
+// other parameter sets than the default are kept in their own directory, as the fault counts they use differ
+func statsFileName(opts *attackOptions, name string) string {
+	if opts.paramSet != "" && opts.paramSet != defaultParameterSet {
+		name = opts.paramSet + "/" + name
+	}
+	// runs with faults that can miss, or a custom magnitude, are kept apart from the default runs
+	if opts.magnitude != "" {
+		name += "-m" + strings.ReplaceAll(opts.magnitude, ":", "")
+	}
+	if opts.probability < 1 {
+		name += fmt.Sprintf("-p%g", opts.probability)
+	}
+	if opts.derive {
+		name += "-derive"
+	}
+	if opts.distinct {
+		name += "-distinct"
+	}
+	layer := fmt.Sprintf("-layer%d", opts.faultLayer)
+	if opts.layers != "" {
+		layer = "-layers" + strings.NewReplacer(":", "w", ",", "_").Replace(opts.layers)
+	}
+	if opts.fault == bitFlipFault {
+		if opts.layers == "" && opts.faultLayer == opts.params.D-2 {
+			return fmt.Sprintf("data/%s.csv", name)
+		}
+		return fmt.Sprintf("data/%s%s.csv", name, layer)
+	}
+	switch opts.fault {
+	case chainSkipFault:
+		return fmt.Sprintf("data/%s-skip%d%s.csv", name, opts.skips, layer)
+	case rootFault:
+		return fmt.Sprintf("data/%s-root%d%s.csv", name, opts.height, layer)
+	}
+	return fmt.Sprintf("data/%s-%s%s.csv", name, opts.fault, layer)
+}
+
 func appendToFile(filename string, line string) {
+	if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+		panic(err)
+	}
 	f, err := os.OpenFile(filename, os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0600)
 	if err != nil {
 		panic(err)
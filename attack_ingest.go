@@ -0,0 +1,214 @@
+package main
+
+import (
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"github.com/kasperdi/SPHINCSPLUS-golang/attack"
+	"github.com/kasperdi/SPHINCSPLUS-golang/parameters"
+	"github.com/kasperdi/SPHINCSPLUS-golang/sphincs"
+	"github.com/kasperdi/SPHINCSPLUS-golang/util"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+)
+
+// ingest runs the processing phase of the attacks on signatures captured elsewhere, e.g. from a hardware bench, and
+// reports whether they are enough to forge
+func ingest(args []string) {
+	flags := flag.NewFlagSet("ingest", flag.ExitOnError)
+	paramSet := flags.String("params", defaultParameterSet, "parameter set of the captured signatures")
+	pkFile := flags.String("pk", "", "file holding the public key, hex or raw")
+	messageHex := flags.String("message", "", "hex message every captured signature signs")
+	messageFile := flags.String("messageFile", "", "file holding the raw message every captured signature signs")
+	validMessages := flags.String("validMessages", "", "file of the hex message signed by each valid signature, one per line in capture order")
+	faultyMessages := flags.String("faultyMessages", "", "file of the hex message signed by each faulty signature, one per line in capture order")
+	validPath := flags.String("valid", "", "file or directory of captured valid signatures, hex or raw")
+	faultyPath := flags.String("faulty", "", "file or directory of captured faulty signatures, hex or raw")
+	fault := flags.String("fault", bitFlipFault, "fault type the signatures were captured with: bitflip, skip, abort or root")
+	faultLayer := flags.Int("layer", -1, "hypertree layer faulted (default D-2 for bitflip, D-1 for chain faults)")
+	layers := flags.String("layers", "", "layers that may have been faulted, e.g. 13,14")
+	derive := flags.Bool("derive", false, "derive the top layer WOTS keys from the faulty signatures alone")
+	save := flags.String("save", "", "save the attack to this file, for the forge command")
+	attempts := flags.Int("attempts", 1000, "forgery attempts, or 0 not to forge")
+	seedHex := flags.String("seed", "", "hex seed for the forgery attempts (random if not given)")
+	if err := flags.Parse(args); err != nil {
+		panic(err)
+	}
+	params := parseParameterSet(*paramSet, true)
+	if *pkFile == "" || *faultyPath == "" || *messageHex != "" && *messageFile != "" {
+		fmt.Println("pk and faulty must be given, and at most one of message and messageFile")
+		os.Exit(1)
+	}
+	oneMessage := *messageHex != "" || *messageFile != ""
+	if !oneMessage && (*faultyMessages == "" || *validPath != "" && *validMessages == "") {
+		fmt.Println("one of message and messageFile must be given, unless every signature's message is")
+		os.Exit(1)
+	}
+	if *attempts < 0 {
+		fmt.Println("attempts can't be negative")
+		os.Exit(1)
+	}
+	opts := &attackOptions{params: params, paramSet: strings.ToLower(*paramSet), fault: *fault, faultLayer: *faultLayer,
+		skips: 1, height: params.Hprime, probability: 1, layers: *layers, derive: *derive}
+	if err := opts.validate(); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	if *validPath == "" && !opts.derive {
+		fmt.Println("valid signatures must be given, unless the keys are derived")
+		os.Exit(1)
+	}
+
+	rng := util.NewDRBG(parseSeed(*seedHex))
+
+	pk, err := attack.ReadPublicKey(params, *pkFile)
+	if err != nil {
+		fmt.Printf("could not read public key: %s\n", err)
+		os.Exit(1)
+	}
+	var message []byte
+	if oneMessage {
+		message = readMessage(*messageHex, *messageFile)
+	}
+	validSignatures := readSignatures(params, *validPath)
+	faultySignatures := readSignatures(params, *faultyPath)
+	signedValid := captureMessages(*validMessages, len(validSignatures), message)
+	signedFaulty := captureMessages(*faultyMessages, len(faultySignatures), message)
+	if oneMessage {
+		fmt.Printf("Read %d valid and %d faulty signatures of %x\n", len(validSignatures), len(faultySignatures), message)
+	} else {
+		fmt.Printf("Read %d valid and %d faulty signatures, each of its own message\n", len(validSignatures), len(faultySignatures))
+	}
+
+	collector := attack.NewCollector(params, pk, message, opts.targetLayers())
+	for i, signature := range validSignatures {
+		if _, err := collector.AddValidMessage(signedValid[i], signature); err != nil {
+			fmt.Printf("Valid signature %d doesn't verify, skipping it\n", i+1)
+		}
+	}
+	if !opts.derive && collector.Remaining() > 0 {
+		fmt.Printf("No valid signature through %d WOTS keys of the target layers, their faulty signatures are skipped\n", collector.Remaining())
+	}
+
+	faulted, shorter, unknown := 0, 0, 0
+	for i, signature := range faultySignatures {
+		result := addFaulty(collector, signedFaulty[i], signature, opts.derive)
+		if len(result.FaultedLayers) > 0 {
+			faulted += 1
+		}
+		if len(result.Shorter) > 0 {
+			shorter += 1
+		}
+		if len(result.Unknown) > 0 {
+			unknown += 1
+		}
+	}
+	fmt.Printf("%d faulty signatures were faulted in a target layer, %d gave shorter hash chains and %d used unknown keys\n", faulted, shorter, unknown)
+
+	for _, key := range sortedKeys(collector) {
+		state := collector.States[key]
+		fmt.Printf("Layer %d WOTS key %d of tree %d, %.4f of messages signable with shortest hash chains:\n",
+			key.Layer, key.Leaf, key.Tree, attack.SignableFraction(params, state.HashCount, rng))
+		printIntArrayPadded(state.HashCount)
+	}
+
+	if *save != "" {
+		state, err := attack.NewState(collector, opts.paramSet)
+		if err != nil {
+			panic(err)
+		}
+		if err := attack.WriteState(*save, state); err != nil {
+			fmt.Printf("could not save attack state: %s\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Saved attack state with %d WOTS keys to %s\n", len(collector.States), *save)
+	}
+	if *attempts == 0 || len(collector.States) == 0 {
+		return
+	}
+
+	forgedMessage := rng.Bytes(params.N)
+	forgedSignature, forgeryAttempts := forgeMessageSignature(attack.NewForger(collector, rng), forgedMessage, *attempts)
+	if forgedSignature == nil {
+		fmt.Printf("Not forgeable: no forgery in %d attempts\n", *attempts)
+		return
+	}
+	if sphincs.Spx_verify(params, forgedMessage, forgedSignature, pk) {
+		fmt.Printf("Forgeable: forged a signature of %x in %d attempts\n", forgedMessage, forgeryAttempts)
+	} else {
+		fmt.Println("Didn't quite work :(")
+	}
+}
+
+// readMessage reads the message signed by the captured signatures from its hex or from a file
+func readMessage(messageHex string, messageFile string) []byte {
+	if messageFile != "" {
+		message, err := ioutil.ReadFile(messageFile)
+		if err != nil {
+			fmt.Printf("could not read message: %s\n", err)
+			os.Exit(1)
+		}
+		return message
+	}
+	message, err := hex.DecodeString(messageHex)
+	if err != nil {
+		fmt.Printf("message must be hex encoded: %s\n", err)
+		os.Exit(1)
+	}
+	return message
+}
+
+// captureMessages returns the message signed by each of count captures, read from filename if given or message
+// otherwise, exiting if there isn't one message for every capture
+func captureMessages(filename string, count int, message []byte) [][]byte {
+	messages := make([][]byte, count)
+	if filename == "" {
+		for i := range messages {
+			messages[i] = message
+		}
+		return messages
+	}
+	messages, err := attack.ReadMessages(filename)
+	if err != nil {
+		fmt.Printf("could not read messages: %s\n", err)
+		os.Exit(1)
+	}
+	if len(messages) != count {
+		fmt.Printf("%s holds %d messages for %d signatures\n", filename, len(messages), count)
+		os.Exit(1)
+	}
+	return messages
+}
+
+// readSignatures reads the signatures captured in path, if given, exiting if they can't be read
+func readSignatures(params *parameters.Parameters, path string) []*sphincs.SPHINCS_SIG {
+	if path == "" {
+		return nil
+	}
+	signatures, err := attack.ReadSignatures(params, path)
+	if err != nil {
+		fmt.Printf("could not read signatures: %s\n", err)
+		os.Exit(1)
+	}
+	return signatures
+}
+
+// sortedKeys returns the keys of the collector's states in layer, tree and leaf order
+func sortedKeys(collector *attack.Collector) []attack.WOTSKey {
+	keys := make([]attack.WOTSKey, 0, len(collector.States))
+	for key := range collector.States {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].Layer != keys[j].Layer {
+			return keys[i].Layer < keys[j].Layer
+		}
+		if keys[i].Tree != keys[j].Tree {
+			return keys[i].Tree < keys[j].Tree
+		}
+		return keys[i].Leaf < keys[j].Leaf
+	})
+	return keys
+}
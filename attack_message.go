@@ -0,0 +1,92 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"github.com/kasperdi/SPHINCSPLUS-golang/attack"
+	"github.com/kasperdi/SPHINCSPLUS-golang/parameters"
+	"github.com/kasperdi/SPHINCSPLUS-golang/sphincs"
+	"github.com/kasperdi/SPHINCSPLUS-golang/util"
+	mathrand "math/rand"
+	"os"
+)
+
+// messageFaultResults counts what happened to the faulty signatures of one fault target
+type messageFaultResults struct {
+	trials    int
+	unchanged int // the fault didn't change the signature
+	verified  int // the faulty signature still verifies
+	forsLeak  int // the FORS key pair of the valid signature signed a different FORS message
+	wotsLeak  int // a WOTS key of the valid signature signed a different message
+}
+
+// messageFaults corrupts R, the message digest and the extracted indices, and reports how exploitable the signatures are
+func messageFaults(args []string) {
+	// sphincs+ parameters
+	params := parameters.MakeSphincsPlusSHA256256fRobust(true)
+
+	flags := flag.NewFlagSet("messageFaults", flag.ExitOnError)
+	bits := flags.Int("bits", 1, "number of bits flipped by each fault")
+	trials := flags.Int("trials", 10, "faulty signatures per fault target")
+	seedHex := flags.String("seed", "", "hex seed for all randomness used in the run (random if not given)")
+	if err := flags.Parse(args); err != nil {
+		panic(err)
+	}
+	if *bits < 1 || *trials < 1 {
+		fmt.Println("bits and trials must be at least 1")
+		os.Exit(1)
+	}
+	rng := util.NewDRBG(parseSeed(*seedHex))
+
+	sk, pk := sphincs.Spx_keygen_rng(params, rng)
+	faultRand := mathrand.New(util.NewDRBG(rng.Bytes(32)))
+
+	fmt.Printf("%-8s %9s %9s %9s %9s %9s\n", "target", "trials", "unchanged", "verified", "forsLeak", "wotsLeak")
+	for _, target := range []string{sphincs.RTarget, sphincs.DigestTarget, sphincs.IdxTreeTarget, sphincs.IdxLeafTarget} {
+		results := new(messageFaultResults)
+		faultModel := &sphincs.MessageFault{Target: target, Bits: *bits, Rand: faultRand}
+		for i := 0; i < *trials; i++ {
+			// sign with the same randomness so the faulty signature can be compared with the valid one
+			message := rng.Bytes(params.N)
+			signSeed := rng.Bytes(32)
+			validSignature := sphincs.Spx_sign_rng(params, message, sk, util.NewDRBG(signSeed))
+			faultySignature, report := sphincs.Spx_sign_fault_report(params, message, sk, faultModel, util.NewDRBG(signSeed))
+			results.add(params, message, pk, validSignature, faultySignature, report)
+		}
+		fmt.Printf("%-8s %9d %9d %9d %9d %9d\n", target, results.trials, results.unchanged, results.verified, results.forsLeak, results.wotsLeak)
+	}
+}
+
+func (r *messageFaultResults) add(params *parameters.Parameters, message []byte, pk *sphincs.SPHINCS_PK,
+	validSignature *sphincs.SPHINCS_SIG, faultySignature *sphincs.SPHINCS_SIG, report *sphincs.FaultReport) {
+
+	r.trials += 1
+	if !report.Faulted() {
+		r.unchanged += 1
+		return
+	}
+	if sphincs.Spx_verify(params, message, faultySignature, pk) {
+		r.verified += 1
+	}
+
+	_, idxTree, idxLeaf := attack.Digest(params, validSignature.R, pk, message)
+	if report.IdxTree == idxTree && report.IdxLeaf == idxLeaf && report.MdChanged {
+		// revealed FORS secret leaves which the valid signature didn't
+		for i := 0; i < params.K; i++ {
+			if !bytes.Equal(validSignature.SIG_FORS.GetSK(i), faultySignature.SIG_FORS.GetSK(i)) {
+				r.forsLeak += 1
+				break
+			}
+		}
+	}
+
+	for layer := 0; layer < params.D; layer++ {
+		// WOTS signatures are deterministic, so a different signature by the same key means a different message
+		if attack.KeyFromIdx(params, idxTree, idxLeaf, layer) == attack.KeyFromIdx(params, report.IdxTree, report.IdxLeaf, layer) &&
+			!bytes.Equal(validSignature.SIG_HT.GetXMSSSignature(layer).WotsSignature, faultySignature.SIG_HT.GetXMSSSignature(layer).WotsSignature) {
+			r.wotsLeak += 1
+			break
+		}
+	}
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/kasperdi/SPHINCSPLUS-golang/attack"
+	"github.com/kasperdi/SPHINCSPLUS-golang/hypertree"
+	"github.com/kasperdi/SPHINCSPLUS-golang/parameters"
+	"github.com/kasperdi/SPHINCSPLUS-golang/sphincs"
+	"github.com/kasperdi/SPHINCSPLUS-golang/util"
+	mathrand "math/rand"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// layerCounts counts what the faulty signatures showed about one layer
+type layerCounts struct {
+	detected   int // faulty signatures where the layer was detected as faulted
+	truth      int // faulty signatures where the layer was actually faulted
+	newMessage int // faulty signatures where the layer signed a different message
+	leaked     int // faulty signatures leaking shorter hash chains
+}
+
+// multiLayerFaults faults several hypertree layers, and optionally FORS, in every faulty signature. The attacker
+// detects which layers were faulted from the messages each layer signs and collects the WOTS chain values leaked by
+// every layer, then tries to forge through each layer it learnt something about
+func multiLayerFaults(args []string) {
+	// deterministic signing, so every faulty signature of the same message uses the same WOTS keys in every layer
+	params := parameters.MakeSphincsPlusSHA256256fRobust(false)
+
+	flags := flag.NewFlagSet("multiLayerFaults", flag.ExitOnError)
+	layersList := flags.String("layers", fmt.Sprintf("%d,%d", params.D-3, params.D-2), "comma separated hypertree layers to flip bits in")
+	magnitude := flags.String("magnitude", "", "bits flipped in each layer: fixed:<n>, uniform:<max> or geometric:<p> (default up to 64)")
+	forsTarget := flags.String("fors", "", "also fault FORS in every signature: indices or treepkauth")
+	forsBits := flags.Int("forsBits", 1, "number of bits flipped by the FORS fault")
+	faults := flags.Int("faults", 300, "number of faulty signatures")
+	attempts := flags.Int("attempts", 100, "forgery attempts through each layer")
+	seedHex := flags.String("seed", "", "hex seed for all randomness used in the run (random if not given)")
+	if err := flags.Parse(args); err != nil {
+		panic(err)
+	}
+
+	var layerMagnitude hypertree.Magnitude
+	if *magnitude != "" {
+		var err error
+		if layerMagnitude, err = parseMagnitude(*magnitude); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+	}
+	if *forsTarget != "" && *forsTarget != sphincs.IndicesTarget && *forsTarget != sphincs.TreePKAUTHTarget {
+		fmt.Printf("unknown FORS fault target %s\n", *forsTarget)
+		os.Exit(1)
+	}
+	if *faults < 1 || *attempts < 1 || *forsBits < 1 {
+		fmt.Println("faults, attempts and forsBits must be at least 1")
+		os.Exit(1)
+	}
+	rng := util.NewDRBG(parseSeed(*seedHex))
+
+	faultRand := mathrand.New(util.NewDRBG(rng.Bytes(32)))
+	faultModel := &sphincs.MultiFault{MultiFault: new(hypertree.MultiFault)}
+	for _, layer := range parseLayers(params, *layersList) {
+		faultModel.Faults = append(faultModel.Faults, &hypertree.BitFlipFault{MaxBits: 64, Layer: layer, Magnitude: layerMagnitude, Rand: faultRand})
+	}
+	if *forsTarget != "" {
+		faultModel.Fors = &sphincs.ForsFault{Target: *forsTarget, Bits: *forsBits, Rand: faultRand}
+	}
+
+	oracleRng := util.NewDRBG(rng.Bytes(32))
+	oracle := createSigningOracle(params, faultModel, 1, nil, params.D-1, oracleRng)
+	pk := oracle.PublicKey()
+
+	// sign correctly
+	message := rng.Bytes(params.N)
+	goodSignature := querySign(oracle, message)
+
+	// every layer is a target, so a new message signed by a layer shows the layer below it was faulted
+	allLayers := make([]int, params.D)
+	for j := range allLayers {
+		allLayers[j] = j
+	}
+	collector := attack.NewCollector(params, pk, message, allLayers)
+	if _, err := collector.AddValid(goodSignature); err != nil {
+		panic("Good signature didn't sign :(")
+	}
+
+	layers := make([]*layerCounts, params.D)
+	for j := range layers {
+		layers[j] = new(layerCounts)
+	}
+	forsDetected, exact := 0, 0
+	for f := 1; f <= *faults; f++ {
+		// sign the same message but cause faults
+		result := collector.AddFaulty(querySignFaulty(oracle, message))
+		if result.ForsChanged {
+			forsDetected += 1
+			layers[0].newMessage += 1
+		}
+		for _, j := range result.FaultedLayers {
+			layers[j].detected += 1
+			if j < params.D-1 {
+				layers[j+1].newMessage += 1
+			}
+		}
+		for _, key := range result.Shorter {
+			layers[key.Layer].leaked += 1
+		}
+		fmt.Printf("Faulty signature %d: layers %v faulted, FORS public key changed %t\n", f, result.FaultedLayers, result.ForsChanged)
+
+		// compare the detected layers with the truth, for the experimenter only
+		report := oracle.faults.Reports()[f-1]
+		matches := true
+		for j := 0; j < params.D; j++ {
+			faulted := report.Layer(j) != nil && report.Layer(j).RootChanged
+			if faulted {
+				layers[j].truth += 1
+			}
+			if faulted != result.Faulted(j) {
+				matches = false
+			}
+		}
+		if matches {
+			exact += 1
+		}
+	}
+
+	closeOracle(oracle)
+	oracle.faults.printForsSummary()
+	fmt.Printf("[Truth] faulted layers detected exactly in %d of %d faulty signatures\n", exact, *faults)
+	fmt.Printf("FORS public key changed in %d faulty signatures\n", forsDetected)
+
+	fmt.Printf("%-5s %9s %9s %11s %9s %11s\n", "layer", "detected", "[truth]", "newMessage", "leaked", "signable")
+	for j := params.D - 1; j >= 0; j-- {
+		l := layers[j]
+		if l.detected == 0 && l.truth == 0 && l.newMessage == 0 && l.leaked == 0 {
+			continue
+		}
+		state := collector.States[attack.KeyFromMsg(params, goodSignature.R, pk, message, j)]
+		fmt.Printf("%-5d %9d %9d %11d %9d %11.4f\n", j, l.detected, l.truth, l.newMessage, l.leaked, attack.SignableFraction(params, state.HashCount, rng))
+	}
+
+	// forge through every layer which leaked chain values, as long as finding a matching key is cheap enough
+	for j := params.D - 1; j >= 0; j-- {
+		if layers[j].leaked == 0 {
+			continue
+		}
+		if keyBits := (params.D - j) * params.Hprime; keyBits > 20 {
+			fmt.Printf("Layer %d leaked chain values, but finding a randomizer using its WOTS key takes 2^%d tries on average\n", j, keyBits)
+			continue
+		}
+		forger := &attack.Forger{Params: params, PK: pk, TargetLayers: []int{j}, States: collector.States, Rand: rng}
+		_, tries, err := forger.Forge(rng.Bytes(params.N), *attempts)
+		switch err {
+		case nil:
+			fmt.Printf("Forged signature through layer %d after %d attempts!!!!\n", j, tries)
+		case attack.ErrNoForgery:
+			fmt.Printf("Couldn't forge through layer %d in %d attempts :(\n", j, *attempts)
+		default:
+			fmt.Printf("Failed to forge through layer %d when should have been successful\n", j)
+		}
+	}
+}
+
+// parseLayers parses a comma separated list of hypertree layers
+func parseLayers(params *parameters.Parameters, list string) []int {
+	layers := make([]int, 0)
+	for _, field := range strings.Split(list, ",") {
+		layer, err := strconv.Atoi(strings.TrimSpace(field))
+		if err != nil || layer < 0 || layer > params.D-1 {
+			fmt.Printf("layers must be between 0 and %d\n", params.D-1)
+			os.Exit(1)
+		}
+		layers = append(layers, layer)
+	}
+	return layers
+}
@@ -1,48 +1,52 @@
 package main
 
 import (
-	"crypto/rand"
 	"fmt"
-	"github.com/kasperdi/SPHINCSPLUS-golang/parameters"
+	"github.com/kasperdi/SPHINCSPLUS-golang/attack"
 	"github.com/kasperdi/SPHINCSPLUS-golang/sphincs"
-	"time"
+	"github.com/kasperdi/SPHINCSPLUS-golang/util"
 )
 
-func parallelSubtree() {
-	// sphincs+ parameters
-	params := parameters.MakeSphincsPlusSHA256256fRobust(true)
+func parallelSubtree(opts *attackOptions) {
+	params := opts.params
+	collector := loadAttack(opts)
+	rng := util.NewDRBG(opts.seed)
 
 	// create random message to sign
-	goodMessage := make([]byte, params.N)
-	_, err := rand.Read(goodMessage)
-	if err != nil {
-		panic(err)
-	}
+	goodMessage := rng.Bytes(params.N)
 
-	// createSigningOracle returns only the public key and channels for messages and signatures
-	pk, oracleInput, oracleResponse, oracleInputFaulty, oracleResponseFaulty := createSigningOracle(params)
+	// the attack only sees the oracle's public key and the signatures it returns
+	oracle, faultTruth := createSeededSigningOracle(opts, rng)
+	pk := oracle.PublicKey()
 
-	// sign correctly until each WOTS public key is recovered
-	hashCounts, shortestHashChains, wotsPublicKeys, authPaths :=
-		getPublicKeyChainLengthAndAuthPaths(params, oracleInput, oracleResponse, pk, goodMessage)
+	if collector == nil {
+		// the WOTS keys signing the faulted layers' roots are re-used, or the faulted keys themselves for chain faults
+		collector = attack.NewCollector(params, pk, goodMessage, opts.targetLayers())
+	} else {
+		rng = resumeAttack(opts, collector, pk)
+	}
+	messages := newMessageSource(opts, goodMessage, opts.seed)
+
+	// sign correctly until each WOTS public key is recovered, unless they are derived from the faulty signatures
+	if !opts.derive {
+		getPublicKeyChainLengthAndAuthPaths(collector, oracle, messages)
+	}
 
 	// process faults
-	shortestHashChains, hashCounts =
-		faultySignAndCreateShortestHashChainsParallel(goodMessage, oracleInputFaulty, oracleResponseFaulty, params, pk, hashCounts, shortestHashChains, wotsPublicKeys)
+	faultySignAndCreateShortestHashChainsParallel(collector, oracle, messages, opts.derive)
 
-	oracleInput <- nil // stop oracle thread
-	time.Sleep(time.Millisecond * 100)
+	closeOracle(oracle)
+	if faultTruth != nil {
+		faultTruth.printSummary(opts.faultedLayers())
+	}
+	saveAttack(opts, collector)
 
 	fmt.Println("We can now sign anything given each block of the message is strictly greater than its respective shortest hash chain")
 
 	// create message to try and forge a signature for
-	forgedMessage := make([]byte, params.N)
-	_, err = rand.Read(forgedMessage)
-	if err != nil {
-		panic(err)
-	}
+	forgedMessage := rng.Bytes(params.N)
 
-	forgedSignature := forgeMessageSignatureParallel(params, forgedMessage, pk, hashCounts, shortestHashChains, authPaths)
+	forgedSignature, _ := forgeMessageSignature(attack.NewForger(collector, rng), forgedMessage, 0)
 
 	// check our forged message signs. We had no knowledge of sk :)
 	if sphincs.Spx_verify(params, forgedMessage, forgedSignature, pk) {
@@ -52,45 +56,19 @@ func parallelSubtree() {
 	}
 }
 
-func getPublicKeyChainLengthAndAuthPaths(params *parameters.Parameters, oracleInput chan []byte,
-	oracleResponse chan *sphincs.SPHINCS_SIG, pk *sphincs.SPHINCS_PK, message []byte) ([][]int, [][]byte, [][]byte, [][]byte) {
-
-	treesToObserve := 1 << (params.H / params.D)
-	hashCounts := make([][]int, treesToObserve)
-	shortestHashChains := make([][]byte, treesToObserve)
-	wotsPublicKeys := make([][]byte, treesToObserve)
-	authPaths := make([][]byte, treesToObserve)
-
-	for treesToObserve > 0 {
-		oracleInput <- message
-		goodSignature := <-oracleResponse
+// getPublicKeyChainLengthAndAuthPaths signs correctly until every WOTS key of each target layer has been seen
+func getPublicKeyChainLengthAndAuthPaths(collector *attack.Collector, oracle attack.SigningOracle, messages *attack.MessageSource) {
+	for collector.Remaining() > 0 {
+		message := messages.Next()
+		goodSignature := querySign(oracle, message)
 
-		lastTreeIdx := getLastTreeIdxFromMsg(params, goodSignature.R, pk, message)
-		if len(hashCounts[lastTreeIdx]) != 0 { // if we already have a signature using this subtree skip
-			continue
-		}
-
-		success, wotsMsg, wotsSig, _ := sphincs.Spx_verify_get_msg_sig_tree(params, message, goodSignature, pk)
-		if !success {
+		if _, err := collector.AddValidMessage(message, goodSignature); err != nil {
 			panic("Good signature didn't sign :(")
 		}
-
-		shortestHashChains[lastTreeIdx] = wotsSig
-		hashCounts[lastTreeIdx] = msgToBaseW(params, wotsMsg)
-		wotsPublicKeys[lastTreeIdx] = getWOTSPKFromMessageAndSignature(params, wotsSig, wotsMsg, pk.PKseed, int(lastTreeIdx))
-		authPaths[lastTreeIdx] = goodSignature.SIG_HT.XMSSSignatures[params.D-1].AUTH
-
-		treesToObserve -= 1
 	}
-
-	return hashCounts, shortestHashChains, wotsPublicKeys, authPaths
 }
 
-func faultySignAndCreateShortestHashChainsParallel(
-	message []byte, oracleInputFaulty chan []byte, oracleResponseFaulty chan *sphincs.SPHINCS_SIG,
-	params *parameters.Parameters, pk *sphincs.SPHINCS_PK,
-	hashCounts [][]int, shortestHashChains, wotsPublicKeys [][]byte) ([][]byte, [][]int) {
-
+func faultySignAndCreateShortestHashChainsParallel(collector *attack.Collector, oracle attack.SigningOracle, messages *attack.MessageSource, derive bool) {
 	userInput := waitForUserInput()
 	searching := true
 	for searching { // keep looping until the user presses enter
@@ -98,90 +76,25 @@ func faultySignAndCreateShortestHashChainsParallel(
 		case <-userInput:
 			searching = false // if user has entered input stop
 		default:
-			// sign the same message but cause a fault
-			oracleInputFaulty <- message
-			badSignature := <-oracleResponseFaulty
-			badWotsSignature := badSignature.SIG_HT.GetXMSSSignature(params.D - 1).WotsSignature
-
-			idxTree := getLastTreeIdxFromMsg(params, badSignature.R, pk, message)
-
-			// try to recreate message from signature
-			success, faultyMessage := getWOTSMessageFromSignatureAndPK(badWotsSignature, wotsPublicKeys[idxTree], params, pk.PKseed, int(idxTree))
-			if !success {
-				fmt.Println(idxTree)
-				panic("Can't recreate message with fault from sig on target tree. This should never happen.")
-			}
-
-			smaller := false
-			for block := 0; block < params.Len; block++ {
-				// if a sig with fewer hashes of a WOTS sk is found, update the shortest hash chain
-				if hashCounts[idxTree][block] > faultyMessage[block] {
-					smaller = true
-					copy(shortestHashChains[idxTree][block*params.N:(block+1)*params.N], badWotsSignature[block*params.N:(block+1)*params.N])
-					hashCounts[idxTree][block] = faultyMessage[block]
-				}
-			}
-
-			if smaller {
-				fmt.Println("New shortest set of hash chains: ")
-				printIntArrayPadded(hashCounts[idxTree])
-			} else {
-				fmt.Println("New non-smaller set of hash chains found")
+			// sign the next message but cause a fault
+			message := messages.Next()
+			badSignature := querySignFaulty(oracle, message)
+			if badSignature == nil {
+				return
 			}
 
+			printFaultyResult(collector, addFaulty(collector, message, badSignature, derive))
 		}
 	}
-
-	return shortestHashChains, hashCounts
 }
 
-func forgeMessageSignatureParallel(params *parameters.Parameters, message []byte, pk *sphincs.SPHINCS_PK,
-	hashCounts [][]int, smallestSignatures, authPaths [][]byte) *sphincs.SPHINCS_SIG {
-
-	for {
-		// key pair used to create hypertree to forge signature with
-		fSk, _ := sphincs.Spx_keygen(params)
-		partialFSig := sphincs.Spx_sign(params, message, fSk)
-		tree := getLastTreeIdxFromMsg(params, partialFSig.R, pk, message)
-
-		// see if we can forge the WOTS of this message, given our hashCount
-		_, wotsMsg, _, _ := sphincs.Spx_verify_get_msg_sig_tree(params, message, partialFSig, pk)
-		messageBlocks := msgToBaseW(params, wotsMsg)
-
-		signable := true
-		for i := 0; i < params.Len; i++ {
-			if messageBlocks[i] < hashCounts[tree][i] {
-				signable = false
-			}
-		}
-		if !signable {
-			fmt.Println("Message was not signable with our recovered shortest hash chain length :(")
-			printHashCountVsMessageBlocks(messageBlocks, hashCounts[tree])
-			continue
-		}
-
-		fmt.Println("Attempting to forge with required chain lengths:")
-		printIntArrayPadded(messageBlocks)
-		fmt.Println("Each of which is greater than or equal to the shortest chain lengths:")
-		printIntArrayPadded(hashCounts[tree])
-		// create forgery
-		forgedSignature := partialFSig
-		fWotsSig := forgeOTSignature(params, hashCounts[tree], messageBlocks, smallestSignatures[tree], pk.PKseed, tree)
-		forgedSignature.SIG_HT.XMSSSignatures[params.D-1].WotsSignature = fWotsSig
-		forgedSignature.SIG_HT.XMSSSignatures[params.D-1].AUTH = authPaths[tree]
-
-		// verify forgery signs
-		if sphincs.Spx_verify(params, message, partialFSig, pk) {
-			fmt.Println("Forged signature!!!!")
-			return forgedSignature
-		} else {
-			fmt.Println("Failed to forge when should have been successful")
-		}
-
+func parallelSubtreeStats(opts *attackOptions) {
+	seed := opts.seed
+	// the faults are spread over every WOTS key of the target layers, so the counts tried scale with the keys
+	keys := 0
+	for _, targetLayer := range opts.targetLayers() {
+		keys += int(attack.NumberOfWOTSKeys(opts.params, targetLayer))
 	}
-}
-
-func parallelSubtreeStats() {
 	userInput := waitForUserInput()
 	looping := true
 	for looping {
@@ -189,141 +102,91 @@ func parallelSubtreeStats() {
 		case <-userInput:
 			looping = false
 		default:
-			for _, faults := range []int{8 * 16, 10 * 16, 15 * 16, 20 * 16, 30 * 16, 50 * 16} {
-				// sphincs+ parameters
-				params := parameters.MakeSphincsPlusSHA256256fRobust(true)
-
-				// create random message to sign
-				goodMessage := make([]byte, params.N)
-				_, err := rand.Read(goodMessage)
-				if err != nil {
-					panic(err)
-				}
-
-				// createSigningOracle returns only the public key and channels for messages and signatures
-				pk, oracleInput, oracleResponse, oracleInputFaulty, oracleResponseFaulty := createSigningOracle(params)
-
-				// sign correctly until each WOTS public key is recovered
-				hashCounts, shortestHashChains, wotsPublicKeys, authPaths :=
-					getPublicKeyChainLengthAndAuthPaths(params, oracleInput, oracleResponse, pk, goodMessage)
-
-				// process faults
-				shortestHashChains, hashCounts =
-					faultySignAndCreateShortestHashChainsParallelLimited(goodMessage, oracleInputFaulty, oracleResponseFaulty, params, pk, hashCounts, shortestHashChains, wotsPublicKeys, faults)
-
-				oracleInput <- nil // stop oracle thread
-				time.Sleep(time.Millisecond * 100)
-
-				// create message to try and forge a signature for
-				forgedMessage := make([]byte, params.N)
-				_, err = rand.Read(forgedMessage)
-				if err != nil {
-					panic(err)
-				}
-
-				forgedSignature, forgeryAttempts := forgeMessageSignatureParallelLimited(params, forgedMessage, pk, hashCounts, shortestHashChains, authPaths)
-
-				if forgedSignature != nil {
-					// check our forged message signs. We had no knowledge of sk :)
-					if sphincs.Spx_verify(params, forgedMessage, forgedSignature, pk) {
-						fmt.Println("It works!!!!")
-					} else {
-						fmt.Println("Didn't quite work :(")
-						panic(":( This should never happen (I think)")
-					}
-				}
-
-				fmt.Printf("%d forgery attempts required\n", forgeryAttempts)
-				appendToFile("data/parallelAttackStats.csv", fmt.Sprintf("%d, %d", faults, forgeryAttempts))
+			// every fault count of a trial is run from the trial's seed, so re-running with the seed recorded in any
+			// of its rows reproduces them all
+			for _, faultsPerKey := range []int{8, 10, 15, 20, 30, 50} {
+				faults := faultsPerKey * keys
+				forgeryAttempts, effectiveRate := parallelSubtreeTrial(opts, seed, faults, 1000)
+				appendToFile(statsFileName(opts, "parallelAttackStats"), fmt.Sprintf("%d, %d, %g, %.4f, %x", faults, forgeryAttempts, opts.probability, effectiveRate, seed))
 			}
+			seed = nextSeed(seed)
 		}
 	}
 }
 
-func faultySignAndCreateShortestHashChainsParallelLimited(
-	message []byte, oracleInputFaulty chan []byte, oracleResponseFaulty chan *sphincs.SPHINCS_SIG,
-	params *parameters.Parameters, pk *sphincs.SPHINCS_PK,
-	hashCounts [][]int, shortestHashChains, wotsPublicKeys [][]byte, faults int) ([][]byte, [][]int) {
+// parallelSubtreeTrial runs a single parallel attack with the given number of faulty signatures, reproducible from
+// seed. It returns the number of forgery attempts required, or -1 if maxAttempts weren't enough, and the effective
+// fault rate of the oracle
+func parallelSubtreeTrial(opts *attackOptions, seed []byte, faults int, maxAttempts int) (int, float64) {
+	params := opts.params
+	rng := util.NewDRBG(seed)
 
-	for i := 0; i < faults; i++ { // keep looping until the user presses enter
-		// sign the same message but cause a fault
-		oracleInputFaulty <- message
-		badSignature := <-oracleResponseFaulty
-		badWotsSignature := badSignature.SIG_HT.GetXMSSSignature(params.D - 1).WotsSignature
+	// create random message to sign
+	goodMessage := rng.Bytes(params.N)
 
-		idxTree := getLastTreeIdxFromMsg(params, badSignature.R, pk, message)
+	// the attack only sees the oracle's public key and the signatures it returns
+	oracle, faultTruth := createSeededSigningOracle(opts, rng)
+	pk := oracle.PublicKey()
+	collector := attack.NewCollector(params, pk, goodMessage, opts.targetLayers())
+	messages := newMessageSource(opts, goodMessage, seed)
 
-		// try to recreate message from signature
-		success, faultyMessage := getWOTSMessageFromSignatureAndPK(badWotsSignature, wotsPublicKeys[idxTree], params, pk.PKseed, int(idxTree))
-		if !success {
-			fmt.Println(idxTree)
-			panic("Can't recreate message with fault from sig on target tree. This should never happen.")
-		}
+	// sign correctly until each WOTS public key is recovered, unless they are derived from the faulty signatures
+	if !opts.derive {
+		getPublicKeyChainLengthAndAuthPaths(collector, oracle, messages)
+	}
 
-		smaller := false
-		for block := 0; block < params.Len; block++ {
-			// if a sig with fewer hashes of a WOTS sk is found, update the shortest hash chain
-			if hashCounts[idxTree][block] > faultyMessage[block] {
-				smaller = true
-				copy(shortestHashChains[idxTree][block*params.N:(block+1)*params.N], badWotsSignature[block*params.N:(block+1)*params.N])
-				hashCounts[idxTree][block] = faultyMessage[block]
-			}
-		}
+	// process faults
+	faultySignAndCreateShortestHashChainsParallelLimited(collector, oracle, messages, faults, opts.derive)
 
-		if smaller {
-			fmt.Println("New shortest set of hash chains: ")
-			printIntArrayPadded(hashCounts[idxTree])
+	closeOracle(oracle)
+	faultTruth.printSummary(opts.faultedLayers())
+
+	// create message to try and forge a signature for
+	forgedMessage := rng.Bytes(params.N)
+
+	forgedSignature, forgeryAttempts := forgeMessageSignature(attack.NewForger(collector, rng), forgedMessage, maxAttempts)
+
+	if forgedSignature != nil {
+		// check our forged message signs. We had no knowledge of sk :)
+		if sphincs.Spx_verify(params, forgedMessage, forgedSignature, pk) {
+			fmt.Println("It works!!!!")
 		} else {
-			fmt.Println("New non-smaller set of hash chains found")
+			fmt.Println("Didn't quite work :(")
+			panic(":( This should never happen (I think)")
 		}
-
 	}
 
-	return shortestHashChains, hashCounts
+	fmt.Printf("%d forgery attempts required\n", forgeryAttempts)
+	return forgeryAttempts, faultTruth.effectiveRate(opts.faultedLayers())
 }
 
-func forgeMessageSignatureParallelLimited(params *parameters.Parameters, message []byte, pk *sphincs.SPHINCS_PK,
-	hashCounts [][]int, smallestSignatures, authPaths [][]byte) (*sphincs.SPHINCS_SIG, int) {
-
-	for attempt := 1; attempt <= 1000; attempt++ {
-		// key pair used to create hypertree to forge signature with
-		fSk, _ := sphincs.Spx_keygen(params)
-		partialFSig := sphincs.Spx_sign(params, message, fSk)
-		tree := getLastTreeIdxFromMsg(params, partialFSig.R, pk, message)
-
-		// see if we can forge the WOTS of this message, given our hashCount
-		_, wotsMsg, _, _ := sphincs.Spx_verify_get_msg_sig_tree(params, message, partialFSig, pk)
-		messageBlocks := msgToBaseW(params, wotsMsg)
-
-		signable := true
-		for i := 0; i < params.Len; i++ {
-			if messageBlocks[i] < hashCounts[tree][i] {
-				signable = false
-			}
+func faultySignAndCreateShortestHashChainsParallelLimited(collector *attack.Collector, oracle attack.SigningOracle, messages *attack.MessageSource, faults int, derive bool) {
+	identified := make(map[int]int)
+	for i := 0; i < faults; i++ {
+		// sign the next message but cause a fault
+		message := messages.Next()
+		badSignature := querySignFaulty(oracle, message)
+
+		result := addFaulty(collector, message, badSignature, derive)
+		printFaultyResult(collector, result)
+		for _, layer := range result.FaultedLayers {
+			identified[layer] += 1
 		}
-		if !signable {
-			fmt.Println("Message was not signable with our recovered shortest hash chain length :(")
-			printHashCountVsMessageBlocks(messageBlocks, hashCounts[tree])
-			continue
+	}
+	for layer := 0; layer < collector.Params.D; layer++ {
+		if identified[layer] > 0 {
+			fmt.Printf("Identified layer %d as faulted in %d faulty signatures\n", layer, identified[layer])
 		}
+	}
+	if derive {
+		fmt.Printf("Derived %d WOTS keys from faulty signatures alone\n", len(collector.States))
+	}
+}
 
-		fmt.Println("Attempting to forge with required chain lengths:")
-		printIntArrayPadded(messageBlocks)
-		fmt.Println("Each of which is greater than or equal to the shortest chain lengths:")
-		printIntArrayPadded(hashCounts[tree])
-		// create forgery
-		forgedSignature := partialFSig
-		fWotsSig := forgeOTSignature(params, hashCounts[tree], messageBlocks, smallestSignatures[tree], pk.PKseed, tree)
-		forgedSignature.SIG_HT.XMSSSignatures[params.D-1].WotsSignature = fWotsSig
-		forgedSignature.SIG_HT.XMSSSignatures[params.D-1].AUTH = authPaths[tree]
-
-		// verify forgery signs
-		if sphincs.Spx_verify(params, message, partialFSig, pk) {
-			fmt.Println("Forged signature!!!!")
-			return forgedSignature, attempt
-		} else {
-			fmt.Println("Failed to forge when should have been successful")
-		}
+// addFaulty adds a faulty signature of message to the collector, deriving unknown keys from it if derive is set
+func addFaulty(collector *attack.Collector, message []byte, signature *sphincs.SPHINCS_SIG, derive bool) *attack.FaultyResult {
+	if derive {
+		return collector.AddDerivedMessage(message, signature)
 	}
-	return nil, -1
+	return collector.AddFaultyMessage(message, signature)
 }
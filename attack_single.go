@@ -1,48 +1,60 @@
 package main
 
 import (
-	"crypto/rand"
 	"fmt"
+	"github.com/kasperdi/SPHINCSPLUS-golang/attack"
 	"github.com/kasperdi/SPHINCSPLUS-golang/parameters"
 	"github.com/kasperdi/SPHINCSPLUS-golang/sphincs"
-	"time"
+	"github.com/kasperdi/SPHINCSPLUS-golang/util"
+	"io"
 )
 
-func singleSubtree() {
-	// sphincs+ parameters
-	params := parameters.MakeSphincsPlusSHA256256fRobust(true)
+func singleSubtree(opts *attackOptions) {
+	params := opts.params
+	collector := loadAttack(opts)
+	rng := util.NewDRBG(opts.seed)
+	// the WOTS key signing the faulted layer's root is re-used, or the faulted key itself for chain faults
+	targetLayer := opts.targetLayer()
 
 	// create random message to sign
-	goodMessage := make([]byte, params.N)
-	_, err := rand.Read(goodMessage)
-	if err != nil {
-		panic(err)
+	goodMessage := rng.Bytes(params.N)
+
+	// the attack only sees the oracle's public key and the signatures it returns
+	oracle, faultTruth := createSeededSigningOracle(opts, rng)
+	pk := oracle.PublicKey()
+	if collector == nil {
+		// sign correctly
+		goodSignature := querySign(oracle, goodMessage)
+
+		collector = attack.NewCollector(params, pk, goodMessage, []int{targetLayer})
+		if _, err := collector.AddValid(goodSignature); err != nil {
+			panic("Good signature didn't sign :(")
+		}
+	} else {
+		rng = resumeAttack(opts, collector, pk)
 	}
 
-	// createSigningOracle returns only the public key and channels for messages and signatures
-	pk, oracleInput, oracleResponse, oracleInputFaulty, oracleResponseFaulty := createSigningOracle(params)
-	// sign correctly
-	oracleInput <- goodMessage
-	goodSignature := <-oracleResponse
+	faultySignAndCreateShortestHashChains(collector, oracle, newMessageSource(opts, goodMessage, opts.seed))
 
-	shortestHashChains, hashCount, targetIdxTree :=
-		faultySignAndCreateShortestHashChains(goodMessage, goodSignature, oracleInputFaulty, oracleResponseFaulty, params, pk)
-
-	oracleInput <- nil // stop oracle thread
-	time.Sleep(time.Millisecond * 100)
+	closeOracle(oracle)
+	if faultTruth != nil {
+		faultTruth.printSummary(opts.faultedLayers())
+	}
+	saveAttack(opts, collector)
 
+	// the single attack only ever has the state of the valid signature's key
+	var state *attack.ChainState
+	for _, keyState := range collector.States {
+		state = keyState
+	}
 	fmt.Println("We can now sign anything given each block of the message is strictly greater than: ")
-	printIntArrayPadded(hashCount)
-	fmt.Printf("The corresponding smallest hash chain lengths are: %x...\n\n", shortestHashChains[:256])
+	printIntArrayPadded(state.HashCount)
+	fmt.Printf("The corresponding smallest hash chain lengths are: %x...\n\n", state.ShortestHashChains[:8*params.N])
 
 	// create message to try and forge a signature for
-	forgedMessage := make([]byte, params.N)
-	_, err = rand.Read(forgedMessage)
-	if err != nil {
-		panic(err)
-	}
+	forgedMessage := rng.Bytes(params.N)
 
-	forgedSignature := forgeMessageSignature(params, forgedMessage, pk, targetIdxTree, goodSignature, hashCount, shortestHashChains)
+	forgedSignature, _ := forgeMessageSignature(attack.NewForger(collector, rng), forgedMessage, 0)
 
 	// check our forged message signs. We had no knowledge of sk :)
 	if sphincs.Spx_verify(params, forgedMessage, forgedSignature, pk) {
@@ -53,28 +65,10 @@ func singleSubtree() {
 
 }
 
-func faultySignAndCreateShortestHashChains(
-	goodMessage []byte, goodSignature *sphincs.SPHINCS_SIG, oracleInputFaulty chan []byte, oracleResponseFaulty chan *sphincs.SPHINCS_SIG,
-	params *parameters.Parameters, pk *sphincs.SPHINCS_PK) ([]byte, []int, uint64) {
-
+// faultySignAndCreateShortestHashChains collects faulty signatures of the messages until the user presses enter.
+// Signatures using other WOTS keys than the valid signature are discarded
+func faultySignAndCreateShortestHashChains(collector *attack.Collector, oracle attack.SigningOracle, messages *attack.MessageSource) {
 	fmt.Println("Signing faulty messages. Press enter to stop")
-	success, wotsMsg, wotsSig, tree := sphincs.Spx_verify_get_msg_sig_tree(params, goodMessage, goodSignature, pk)
-	if !success {
-		panic("Good signature didn't sign :(")
-	}
-
-	targetIdxTree := tree
-	for j := 1; j < params.D-1; j++ {
-		targetIdxTree = targetIdxTree >> (params.H / params.D)
-	}
-
-	// maintain list of the fewest times hashed sk and how many times it was hashed
-	shortestHashChains := make([]byte, len(wotsSig))
-	copy(shortestHashChains, wotsSig)
-	hashCount := msgToBaseW(params, wotsMsg)
-
-	wotsPk := getWOTSPKFromMessageAndSignature(params, wotsSig, wotsMsg, pk.PKseed, int(targetIdxTree))
-
 	userInput := waitForUserInput()
 	searching := true
 	for searching { // keep looping until the user presses enter
@@ -82,99 +76,24 @@ func faultySignAndCreateShortestHashChains(
 		case <-userInput:
 			searching = false // if user has entered input stop
 		default:
-			// sign the same message but cause a fault
-			oracleInputFaulty <- goodMessage
-			badSig := <-oracleResponseFaulty
-			badWotsSig := badSig.SIG_HT.GetXMSSSignature(params.D - 1).WotsSignature
-
-			if targetIdxTree != getLastTreeIdxFromMsg(params, badSig.R, pk, goodMessage) {
-				continue
-			}
-
-			// try to recreate message from signature
-			success, faultyMessage := getWOTSMessageFromSignatureAndPK(badWotsSig, wotsPk, params, pk.PKseed, int(targetIdxTree))
-			if !success {
-				panic("Can't recreate message with fault from sig on target tree. This should never happen.")
-			}
-
-			smaller := false
-			for block := 0; block < params.Len; block++ {
-				// if a sig with fewer hashes of a WOTS sk is found, update the shortest hash chain
-				if hashCount[block] > faultyMessage[block] {
-					smaller = true
-					copy(shortestHashChains[block*params.N:(block+1)*params.N], badWotsSig[block*params.N:(block+1)*params.N])
-					hashCount[block] = faultyMessage[block]
-				}
+			// sign the next message but cause a fault
+			message := messages.Next()
+			badSig := querySignFaulty(oracle, message)
+			if badSig == nil {
+				return
 			}
 
-			if smaller {
-				fmt.Println("New shortest set of hash chains: ")
-				printIntArrayPadded(hashCount)
-			} else {
-				fmt.Println("New non-smaller set of hash chains found")
+			result := collector.AddFaultyMessage(message, badSig)
+			if len(result.Unknown) > 0 {
+				continue
 			}
-
+			printFaultyResult(collector, result)
 		}
 	}
-
-	return shortestHashChains, hashCount, targetIdxTree
 }
 
-func forgeMessageSignature(params *parameters.Parameters, message []byte, pk *sphincs.SPHINCS_PK, targetIdxTree uint64,
-	goodSignature *sphincs.SPHINCS_SIG, hashCount []int, smallestSignature []byte) *sphincs.SPHINCS_SIG {
-
-	for {
-		// key pair used to create hypertree to forge signature with
-		fSk, _ := sphincs.Spx_keygen(params)
-		// check partialFSig signed with pk last tree_idx is the same as with signing with fPk
-		partialFSig := sphincs.Spx_sign(params, message, fSk)
-		fmt.Print("Looking for signature with matching final node")
-		for targetIdxTree != getLastTreeIdxFromMsg(params, partialFSig.R, pk, message) {
-			// pick new keys to forge with in case of not random
-			partialFSig = sphincs.Spx_sign(params, message, fSk)
-			fSk, _ = sphincs.Spx_keygen(params)
-			fmt.Print(".")
-		}
-		fmt.Println(" Found")
-
-		// see if we can forge the WOTS of this message, given our hashCount
-		_, wotsMsg, _, _ := sphincs.Spx_verify_get_msg_sig_tree(params, message, partialFSig, pk)
-		messageBlocks := msgToBaseW(params, wotsMsg)
-
-		signable := true
-		for i := 0; i < params.Len; i++ {
-			if messageBlocks[i] < hashCount[i] {
-				signable = false
-			}
-		}
-		if !signable {
-			fmt.Println("Message was not signable with our recovered shortest hash chain length :(")
-			printHashCountVsMessageBlocks(messageBlocks, hashCount)
-			continue
-		}
-
-		fmt.Println("Attempting to forge with required chain lengths:")
-		printIntArrayPadded(messageBlocks)
-		fmt.Println("Each of which is greater than or equal to the shortest chain lengths:")
-		printIntArrayPadded(hashCount)
-		// create forgery
-		forgedSignature := partialFSig
-		fWotsSig := forgeOTSignature(params, hashCount, messageBlocks, smallestSignature, pk.PKseed, targetIdxTree)
-		forgedSignature.SIG_HT.XMSSSignatures[params.D-1].WotsSignature = fWotsSig
-		forgedSignature.SIG_HT.XMSSSignatures[params.D-1].AUTH = goodSignature.SIG_HT.XMSSSignatures[params.D-1].AUTH
-
-		// verify forgery signs
-		if sphincs.Spx_verify(params, message, partialFSig, pk) {
-			fmt.Println("Forged signature!!!!")
-			return forgedSignature
-		} else {
-			fmt.Println("Failed to forge when should have been successful")
-		}
-
-	}
-}
-
-func singleSubtreeStats() {
+func singleSubtreeStats(opts *attackOptions) {
+	seed := opts.seed
 	userInput := waitForUserInput()
 	looping := true
 	for looping {
@@ -182,123 +101,67 @@ func singleSubtreeStats() {
 		case <-userInput:
 			looping = false
 		default:
-			// sphincs+ parameters
-			params := parameters.MakeSphincsPlusSHA256256fRobust(true)
-
-			// create random message to sign
-			goodMessage := make([]byte, params.N)
-			_, err := rand.Read(goodMessage)
-			if err != nil {
-				panic(err)
-			}
-
-			// createSigningOracle returns only the public key and channels for messages and signatures
-			pk, oracleInput, oracleResponse, oracleInputFaulty, oracleResponseFaulty := createSigningOracle(params)
-			// sign correctly
-			oracleInput <- goodMessage
-			goodSignature := <-oracleResponse
-
-			// create message to try and forge a signature for
-			forgedMessage := make([]byte, params.N)
-			_, err = rand.Read(forgedMessage)
-			if err != nil {
-				panic(err)
-			}
-
-			faultySigsRequired :=
-				findRequiredSignatureNumber(goodMessage, goodSignature, oracleInputFaulty, oracleResponseFaulty, params, pk, forgedMessage)
-
-			oracleInput <- nil // stop oracle thread
-
-			fmt.Printf("%d faulty signatures required\n", faultySigsRequired)
-			appendToFile("data/singleAttackStats.csv", fmt.Sprintf("%d", faultySigsRequired))
+			faultySigsRequired, effectiveRate := singleSubtreeTrial(opts, seed, 2000)
+			appendToFile(statsFileName(opts, "singleAttackStats"), fmt.Sprintf("%d, %g, %.4f, %x", faultySigsRequired, opts.probability, effectiveRate, seed))
+			seed = nextSeed(seed)
 		}
 	}
 }
 
-func findRequiredSignatureNumber(
-	goodMessage []byte, goodSignature *sphincs.SPHINCS_SIG, oracleInputFaulty chan []byte, oracleResponseFaulty chan *sphincs.SPHINCS_SIG,
-	params *parameters.Parameters, pk *sphincs.SPHINCS_PK, forgedMessage []byte) int {
-
-	success, wotsMsg, wotsSig, tree := sphincs.Spx_verify_get_msg_sig_tree(params, goodMessage, goodSignature, pk)
-	if !success {
-		panic("Good signature didn't sign :(")
-	}
+// singleSubtreeTrial runs a single attack reproducible from seed, returning the number of faulty signatures required
+// to forge, or -1 if maxFaultySigs weren't enough, and the effective fault rate of the oracle
+func singleSubtreeTrial(opts *attackOptions, seed []byte, maxFaultySigs int) (int, float64) {
+	params := opts.params
+	rng := util.NewDRBG(seed)
 
-	targetIdxTree := tree
-	for j := 1; j < params.D-1; j++ {
-		targetIdxTree = targetIdxTree >> (params.H / params.D)
-	}
+	// create random message to sign
+	goodMessage := rng.Bytes(params.N)
 
-	// key pair used to create hypertree to forge signature with
-	fSk, _ := sphincs.Spx_keygen(params)
-	// check partialFSig signed with pk last tree_idx is the same as with signing with fPk
-	partialFSig := sphincs.Spx_sign(params, forgedMessage, fSk)
-	for targetIdxTree != getLastTreeIdxFromMsg(params, partialFSig.R, pk, forgedMessage) {
-		// pick new keys to forge with in case of not random
-		partialFSig = sphincs.Spx_sign(params, forgedMessage, fSk)
-		fSk, _ = sphincs.Spx_keygen(params)
-	}
+	// the attack only sees the oracle's public key and the signatures it returns
+	oracle, faultTruth := createSeededSigningOracle(opts, rng)
+	// sign correctly
+	goodSignature := querySign(oracle, goodMessage)
 
-	// maintain list of the fewest times hashed sk and how many times it was hashed
-	shortestHashChains := make([]byte, len(wotsSig))
-	copy(shortestHashChains, wotsSig)
-	hashCount := msgToBaseW(params, wotsMsg)
+	// create message to try and forge a signature for
+	forgedMessage := rng.Bytes(params.N)
 
-	wotsPk := getWOTSPKFromMessageAndSignature(params, wotsSig, wotsMsg, pk.PKseed, int(targetIdxTree))
+	faultySigsRequired := findRequiredSignatureNumber(goodMessage, goodSignature, oracle, newMessageSource(opts, goodMessage, seed),
+		params, forgedMessage, opts.targetLayer(), maxFaultySigs, rng)
 
-	for i := 1; i <= 2000; i++ { // keep looping until max 2000 sigs tried or the forgery succeeds
-		// sign the same message but cause a fault
-		oracleInputFaulty <- goodMessage
-		badSig := <-oracleResponseFaulty
-		badWotsSig := badSig.SIG_HT.GetXMSSSignature(params.D - 1).WotsSignature
+	closeOracle(oracle)
+	faultTruth.printSummary(opts.faultedLayers())
 
-		if targetIdxTree != getLastTreeIdxFromMsg(params, badSig.R, pk, goodMessage) {
-			continue
-		}
+	fmt.Printf("%d faulty signatures required\n", faultySigsRequired)
+	return faultySigsRequired, faultTruth.effectiveRate(opts.faultedLayers())
+}
 
-		// try to recreate message from signature
-		success, faultyMessage := getWOTSMessageFromSignatureAndPK(badWotsSig, wotsPk, params, pk.PKseed, int(targetIdxTree))
-		if !success {
-			panic("Can't recreate message with fault from sig on target tree. This should never happen.")
-		}
+func findRequiredSignatureNumber(
+	goodMessage []byte, goodSignature *sphincs.SPHINCS_SIG, oracle attack.SigningOracle, messages *attack.MessageSource,
+	params *parameters.Parameters, forgedMessage []byte, targetLayer int, maxFaultySigs int, rng io.Reader) int {
 
-		smaller := false
-		for block := 0; block < params.Len; block++ {
-			// if a sig with fewer hashes of a WOTS sk is found, update the shortest hash chain
-			if hashCount[block] > faultyMessage[block] {
-				smaller = true
-				copy(shortestHashChains[block*params.N:(block+1)*params.N], badWotsSig[block*params.N:(block+1)*params.N])
-				hashCount[block] = faultyMessage[block]
-			}
-		}
+	collector := attack.NewCollector(params, oracle.PublicKey(), goodMessage, []int{targetLayer})
+	if _, err := collector.AddValid(goodSignature); err != nil {
+		panic("Good signature didn't sign :(")
+	}
 
-		if smaller {
-			forgeable := checkMessageForgeable(params, forgedMessage, pk, partialFSig, hashCount)
-			if forgeable {
+	// partial signature of the forged message using the same WOTS key as the valid signature
+	forger := attack.NewForger(collector, rng)
+	partialFSig := forger.PartialSignature(forgedMessage)
+
+	for i := 1; i <= maxFaultySigs; i++ { // keep looping until maxFaultySigs sigs tried or the forgery succeeds
+		// sign the next message but cause a fault
+		message := messages.Next()
+		badSig := querySignFaulty(oracle, message)
+
+		if result := collector.AddFaultyMessage(message, badSig); len(result.Shorter) > 0 {
+			// see if we can forge the WOTS of this message, given our hashCount
+			attempt := forger.Check(forgedMessage, partialFSig)
+			printHashCountVsMessageBlocks(attempt.MessageBlocks, attempt.HashCount)
+			fmt.Println()
+			if attempt.Signable {
 				return i
 			}
 		}
 	}
 	return -1
 }
-
-func checkMessageForgeable(params *parameters.Parameters, message []byte, pk *sphincs.SPHINCS_PK,
-	partialFSig *sphincs.SPHINCS_SIG, hashCount []int) bool {
-
-	// see if we can forge the WOTS of this message, given our hashCount
-	_, wotsMsg, _, _ := sphincs.Spx_verify_get_msg_sig_tree(params, message, partialFSig, pk)
-	messageBlocks := msgToBaseW(params, wotsMsg)
-
-	signable := true
-	for i := 0; i < params.Len; i++ {
-		if messageBlocks[i] < hashCount[i] {
-			signable = false
-		}
-	}
-
-	printHashCountVsMessageBlocks(messageBlocks, hashCount)
-	fmt.Println()
-
-	return signable
-}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"github.com/kasperdi/SPHINCSPLUS-golang/attack"
+	"github.com/kasperdi/SPHINCSPLUS-golang/sphincs"
+	"github.com/kasperdi/SPHINCSPLUS-golang/util"
+	"os"
+	"reflect"
+	"strconv"
+)
+
+// meta fields of a saved attack state
+const (
+	seedMeta    = "seed"    // seed of the run which started the attack, which the simulated oracle's key pair comes from
+	sessionMeta = "session" // number of times the attack was resumed before it was saved
+)
+
+// loadAttack reads the attack state saved in opts.load, or returns nil if there isn't one. The seed and session of
+// the saved attack replace those of opts, so the simulated oracle is re-created with the same key pair
+func loadAttack(opts *attackOptions) *attack.Collector {
+	if opts.load == "" {
+		return nil
+	}
+	state, err := attack.ReadState(opts.load)
+	if err != nil {
+		fmt.Printf("could not read attack state %s: %s\n", opts.load, err)
+		os.Exit(1)
+	}
+	if state.Params != opts.paramSet {
+		fmt.Printf("attack state is for parameter set %s, run with -params %s\n", state.Params, state.Params)
+		os.Exit(1)
+	}
+	if !reflect.DeepEqual(state.TargetLayers, opts.targetLayers()) {
+		fmt.Printf("attack state attacks layers %v, run with the same fault options\n", state.TargetLayers)
+		os.Exit(1)
+	}
+	collector, err := state.Collector(opts.params)
+	if err != nil {
+		fmt.Printf("could not load attack state %s: %s\n", opts.load, err)
+		os.Exit(1)
+	}
+	seed, err := hex.DecodeString(state.Meta[seedMeta])
+	if err != nil || len(seed) == 0 {
+		fmt.Println("attack state has no seed to re-create the signing oracle from")
+		os.Exit(1)
+	}
+	session, err := strconv.Atoi(state.Meta[sessionMeta])
+	if err != nil {
+		fmt.Println("attack state has no session")
+		os.Exit(1)
+	}
+	opts.seed = seed
+	opts.session = session + 1
+	fmt.Printf("Resuming attack from %s with %d WOTS keys, seed %x session %d\n", opts.load, len(collector.States), opts.seed, opts.session)
+	return collector
+}
+
+// resumeAttack checks the re-created oracle has the key pair of the saved attack, and returns the attacker's
+// randomness for the new session
+func resumeAttack(opts *attackOptions, collector *attack.Collector, pk *sphincs.SPHINCS_PK) *util.DRBG {
+	if !bytes.Equal(collector.PK.PKseed, pk.PKseed) || !bytes.Equal(collector.PK.PKroot, pk.PKroot) {
+		fmt.Println("re-created signing oracle has a different public key to the attack state")
+		os.Exit(1)
+	}
+	return sessionRng(opts, "attacker")
+}
+
+// sessionRng derives the randomness of one side of a resumed attack from its seed and session
+func sessionRng(opts *attackOptions, side string) *util.DRBG {
+	return util.NewDRBG(append([]byte(fmt.Sprintf("%s session %d", side, opts.session)), opts.seed...))
+}
+
+// saveAttack writes the collector to opts.save, if given
+func saveAttack(opts *attackOptions, collector *attack.Collector) {
+	if opts.save == "" {
+		return
+	}
+	state, err := attack.NewState(collector, opts.paramSet)
+	if err != nil {
+		panic(err)
+	}
+	state.Meta = map[string]string{seedMeta: hex.EncodeToString(opts.seed), sessionMeta: strconv.Itoa(opts.session)}
+	if err := attack.WriteState(opts.save, state); err != nil {
+		fmt.Printf("could not save attack state: %s\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Saved attack state with %d WOTS keys to %s\n", len(collector.States), opts.save)
+}
+
+// forgeFromState forges a signature of a random message from a saved attack state, without a signing oracle
+func forgeFromState(args []string) {
+	flags := flag.NewFlagSet("forge", flag.ExitOnError)
+	stateFile := flags.String("state", "", "attack state saved with -save")
+	attempts := flags.Int("attempts", 1000, "forgery attempts")
+	messageHex := flags.String("message", "", "hex message to forge a signature of (random if not given)")
+	seedHex := flags.String("seed", "", "hex seed for all randomness used in the run (random if not given)")
+	if err := flags.Parse(args); err != nil {
+		panic(err)
+	}
+	if *stateFile == "" || *attempts < 1 {
+		fmt.Println("state must be given and attempts must be at least 1")
+		os.Exit(1)
+	}
+	state, err := attack.ReadState(*stateFile)
+	if err != nil {
+		fmt.Printf("could not read attack state %s: %s\n", *stateFile, err)
+		os.Exit(1)
+	}
+	params := parseParameterSet(state.Params, state.Randomize)
+	collector, err := state.Collector(params)
+	if err != nil {
+		fmt.Printf("could not load attack state %s: %s\n", *stateFile, err)
+		os.Exit(1)
+	}
+	rng := util.NewDRBG(parseSeed(*seedHex))
+
+	message := rng.Bytes(params.N)
+	if *messageHex != "" {
+		if message, err = hex.DecodeString(*messageHex); err != nil {
+			fmt.Printf("message must be hex encoded: %s\n", err)
+			os.Exit(1)
+		}
+	}
+	fmt.Printf("Forging a signature of %x with %d WOTS keys\n", message, len(collector.States))
+
+	forgedSignature, forgeryAttempts := forgeMessageSignature(attack.NewForger(collector, rng), message, *attempts)
+	if forgedSignature == nil {
+		fmt.Printf("No forgery in %d attempts\n", *attempts)
+		os.Exit(1)
+	}
+	if sphincs.Spx_verify(params, message, forgedSignature, collector.PK) {
+		fmt.Printf("It works!!!! %d forgery attempts required\n", forgeryAttempts)
+	} else {
+		fmt.Println("Didn't quite work :(")
+	}
+}
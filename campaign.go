@@ -0,0 +1,233 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// campaign attack types
+const (
+	singleCampaign   = "single"   // as singleSubtreeStats
+	parallelCampaign = "parallel" // as parallelSubtreeStats
+)
+
+// campaignConfig describes a fault campaign, read from a JSON file. Optional fields left out take the same defaults
+// as the command line options.
+type campaignConfig struct {
+	Params    string `json:"params"`    // parameter set, e.g. sha256-256f-robust
+	Randomize *bool  `json:"randomize"` // randomized signing, true if not given
+	Attack    string `json:"attack"`    // single or parallel
+
+	Fault       string  `json:"fault"`              // fault type, as -fault
+	Layer       *int    `json:"layer"`              // faulted layer, as -layer
+	Skips       int     `json:"skips"`              // as -skips
+	Height      *int    `json:"height"`             // as -height
+	Probability float64 `json:"probability"`        // as -probability
+	Magnitude   string  `json:"magnitude"`          // as -magnitude
+	Layers      string  `json:"layers,omitempty"`   // as -layers, parallel attacks only
+	Derive      bool    `json:"derive,omitempty"`   // as -derive, parallel attacks only
+	Distinct    bool    `json:"distinct,omitempty"` // as -distinct
+
+	// faulty signatures collected by each parallel trial, every trial is repeated for each count
+	Faults []int `json:"faults"`
+	Trials int   `json:"trials"`
+	Stop   struct {
+		MaxFaultySignatures int    `json:"maxFaultySignatures"` // single attack gives up after this many
+		MaxForgeryAttempts  int    `json:"maxForgeryAttempts"`  // parallel attack gives up after this many
+		MaxDuration         string `json:"maxDuration"`         // no new trials are started after this long
+	} `json:"stop"`
+
+	Seed   string `json:"seed"`   // hex seed of the first trial, random if not given
+	Output string `json:"output"` // results file, data/campaign-<hash>.csv if not given
+}
+
+// campaign runs the fault campaign described by a JSON file, writing every trial tagged with the hash of the config
+func campaign(args []string) {
+	flags := flag.NewFlagSet("campaign", flag.ExitOnError)
+	if err := flags.Parse(args); err != nil {
+		panic(err)
+	}
+	if flags.NArg() != 1 {
+		fmt.Println("usage: campaign <config.json>")
+		os.Exit(1)
+	}
+	raw, err := ioutil.ReadFile(flags.Arg(0))
+	if err != nil {
+		fmt.Printf("couldn't read campaign config: %s\n", err)
+		os.Exit(1)
+	}
+	config, hash, err := parseCampaignConfig(raw)
+	if err != nil {
+		fmt.Printf("invalid campaign config: %s\n", err)
+		os.Exit(1)
+	}
+	opts, err := config.attackOptions()
+	if err != nil {
+		fmt.Printf("invalid campaign config: %s\n", err)
+		os.Exit(1)
+	}
+	if config.Output == "" {
+		config.Output = fmt.Sprintf("data/campaign-%s.csv", hash)
+	}
+	if err := writeCampaignConfig(config.Output, hash, raw); err != nil {
+		fmt.Printf("couldn't save campaign config: %s\n", err)
+		os.Exit(1)
+	}
+
+	var deadline time.Time
+	if config.Stop.MaxDuration != "" {
+		duration, _ := time.ParseDuration(config.Stop.MaxDuration) // already validated
+		deadline = time.Now().Add(duration)
+	}
+	fmt.Printf("Running campaign %s, writing results to %s\n", hash, config.Output)
+
+	seed := opts.seed
+	for trial := 1; trial <= config.Trials; trial++ {
+		if !deadline.IsZero() && time.Now().After(deadline) {
+			fmt.Printf("Campaign stopped after %s, %d of %d trials run\n", config.Stop.MaxDuration, trial-1, config.Trials)
+			return
+		}
+		fmt.Printf("Trial %d of %d\n", trial, config.Trials)
+		switch config.Attack {
+		case singleCampaign:
+			faultySigsRequired, effectiveRate := singleSubtreeTrial(opts, seed, config.Stop.MaxFaultySignatures)
+			appendToFile(config.Output, fmt.Sprintf("%d, %g, %.4f, %x, %s", faultySigsRequired, opts.probability, effectiveRate, seed, hash))
+		case parallelCampaign:
+			// as parallelSubtreeStats, every fault count of a trial is run from the trial's seed
+			for _, faults := range config.Faults {
+				forgeryAttempts, effectiveRate := parallelSubtreeTrial(opts, seed, faults, config.Stop.MaxForgeryAttempts)
+				appendToFile(config.Output, fmt.Sprintf("%d, %d, %g, %.4f, %x, %s", faults, forgeryAttempts, opts.probability, effectiveRate, seed, hash))
+			}
+		}
+		seed = nextSeed(seed)
+	}
+	fmt.Printf("Campaign %s finished\n", hash)
+}
+
+// parseCampaignConfig parses a campaign config, filling in the defaults, and returns it with the hash identifying it.
+// The hash is taken over the config with its defaults, so the formatting of the file doesn't change it
+func parseCampaignConfig(raw []byte) (*campaignConfig, string, error) {
+	config := new(campaignConfig)
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(config); err != nil {
+		return nil, "", err
+	}
+
+	if config.Params == "" {
+		config.Params = defaultParameterSet
+	}
+	config.Params = strings.ToLower(config.Params)
+	if config.Randomize == nil {
+		randomize := true
+		config.Randomize = &randomize
+	}
+	if config.Fault == "" {
+		config.Fault = bitFlipFault
+	}
+	if config.Layer == nil {
+		layer := -1
+		config.Layer = &layer
+	}
+	if config.Skips == 0 {
+		config.Skips = 1
+	}
+	if config.Probability == 0 {
+		config.Probability = 1
+	}
+	if config.Stop.MaxFaultySignatures == 0 {
+		config.Stop.MaxFaultySignatures = 2000
+	}
+	if config.Stop.MaxForgeryAttempts == 0 {
+		config.Stop.MaxForgeryAttempts = 1000
+	}
+
+	switch config.Attack {
+	case singleCampaign:
+		if config.Layers != "" {
+			return nil, "", fmt.Errorf("layers can only be used with the parallel attack")
+		}
+		if config.Derive {
+			return nil, "", fmt.Errorf("derive can only be used with the parallel attack")
+		}
+	case parallelCampaign:
+		// with deterministic signing the attacked message only ever uses one WOTS key of each layer
+		if !*config.Randomize && !config.Distinct {
+			return nil, "", fmt.Errorf("the parallel attack needs randomized signing or distinct messages")
+		}
+		if len(config.Faults) == 0 {
+			return nil, "", fmt.Errorf("parallel campaigns need at least one number of faults")
+		}
+		for _, faults := range config.Faults {
+			if faults < 1 {
+				return nil, "", fmt.Errorf("faults must be at least 1")
+			}
+		}
+	default:
+		return nil, "", fmt.Errorf("attack must be %s or %s", singleCampaign, parallelCampaign)
+	}
+	if _, ok := parameterSets[config.Params]; !ok {
+		return nil, "", fmt.Errorf("unknown parameter set %s", config.Params)
+	}
+	if config.Trials < 1 {
+		return nil, "", fmt.Errorf("trials must be at least 1")
+	}
+	if config.Stop.MaxFaultySignatures < 1 || config.Stop.MaxForgeryAttempts < 1 {
+		return nil, "", fmt.Errorf("stop conditions must be at least 1")
+	}
+	if config.Stop.MaxDuration != "" {
+		if _, err := time.ParseDuration(config.Stop.MaxDuration); err != nil {
+			return nil, "", err
+		}
+	}
+	if config.Seed != "" {
+		if _, err := hex.DecodeString(config.Seed); err != nil {
+			return nil, "", fmt.Errorf("seed must be hex encoded: %s", err)
+		}
+	}
+
+	canonical, err := json.Marshal(config)
+	if err != nil {
+		return nil, "", err
+	}
+	hash := sha256.Sum256(canonical)
+	return config, hex.EncodeToString(hash[:8]), nil
+}
+
+// attackOptions converts the config to the options used by the attacks
+func (config *campaignConfig) attackOptions() (*attackOptions, error) {
+	params := parameterSets[config.Params](*config.Randomize)
+	height := params.Hprime
+	if config.Height != nil {
+		height = *config.Height
+	}
+	opts := &attackOptions{params: params, paramSet: config.Params, fault: config.Fault, faultLayer: *config.Layer, skips: config.Skips, height: height,
+		probability: config.Probability, magnitude: config.Magnitude, layers: config.Layers, derive: config.Derive, distinct: config.Distinct}
+	if err := opts.validate(); err != nil {
+		return nil, err
+	}
+	opts.seed = parseSeed(config.Seed)
+	return opts, nil
+}
+
+// writeCampaignConfig keeps a copy of the config next to the results, so every hash in them can be looked up. The
+// directory of the results is created if it doesn't exist yet
+func writeCampaignConfig(output string, hash string, raw []byte) error {
+	if err := os.MkdirAll(filepath.Dir(output), 0755); err != nil {
+		return err
+	}
+	filename := filepath.Join(filepath.Dir(output), fmt.Sprintf("campaign-%s.json", hash))
+	if _, err := os.Stat(filename); err == nil {
+		return nil
+	}
+	return ioutil.WriteFile(filename, raw, 0644)
+}
@@ -0,0 +1,66 @@
+import math
+import sys
+
+# compares the faulty signatures needed by single attack runs, e.g. root faults against the bit flip results behind
+# the Fig. 5 plot: python3 compareSingleStats.py singleAttackStats.csv singleAttackStats-root-campaign.csv
+
+
+def read(filename):
+    readings = []
+    total = 0
+    with open(filename, "r") as results:
+        for line in results:
+            if not line.strip():
+                continue
+            reading = int(line.strip().split(",")[0])
+            total += 1
+            if reading != -1:
+                readings.append(reading)
+    readings.sort()
+    return readings, total
+
+
+def success(r, t, x):
+    # fraction of runs which forged with fewer than x faulty signatures, as in graph1 of graphResults.py
+    return float(len([ri for ri in r if ri < x])) / float(t)
+
+
+def quantile(r, q):
+    return r[min(len(r) - 1, int(q * len(r)))]
+
+
+def ks(a, b):
+    # two sample Kolmogorov-Smirnov statistic over every run, failures counting as never forging, and its asymptotic
+    # p-value
+    (ra, ta), (rb, tb) = a, b
+    d = max(abs(success(ra, ta, x + 1) - success(rb, tb, x + 1)) for x in set(ra + rb))
+    n = ta * tb / float(ta + tb)
+    z = (math.sqrt(n) + 0.12 + 0.11 / math.sqrt(n)) * d
+    p = 2 * sum((-1) ** (k - 1) * math.exp(-2 * k * k * z * z) for k in range(1, 101))
+    return d, min(1.0, max(0.0, p))
+
+
+results = {filename: read(filename) for filename in sys.argv[1:]}
+print("%-40s %5s %7s %6s %6s %6s %6s" % ("file", "runs", "failed", "q25", "median", "q75", "mean"))
+for filename, (r, t) in results.items():
+    print("%-40s %5d %7d %6d %6d %6d %6.1f" % (filename, t, t - len(r), quantile(r, 0.25), quantile(r, 0.5),
+                                               quantile(r, 0.75), sum(r) / float(len(r))))
+reference = sys.argv[1]
+for filename in sys.argv[2:]:
+    d, p = ks(results[reference], results[filename])
+    print("%s against %s: KS statistic %.3f, p-value %.3f" % (filename, reference, d, p))
+
+try:
+    from matplotlib import pyplot as plt
+except ImportError:
+    print("matplotlib not installed, not plotting")
+    sys.exit()
+for filename, (r, t) in results.items():
+    plt.plot(range(1600), [success(r, t, x) for x in range(1600)], label=filename)
+plt.xlim(0)
+plt.ylim(0)
+plt.xlabel("Number of faulty signatures q")
+plt.ylabel("Success probability")
+plt.legend(loc="lower right")
+plt.grid()
+plt.savefig("compareSingleStats.png")
@@ -1,3 +1,5 @@
+import glob
+
 from matplotlib import pyplot as plt
 
 
@@ -42,13 +44,32 @@ def graph2(r, t):
     plt.show()
 
 
+def graph3(r):
+    for f in sorted(r):
+        rates = sorted(r[f])
+        xs = []
+        ys = []
+        for rate in rates:
+            attempts = r[f][rate]
+            xs.append(sum(a[1] for a in attempts) / len(attempts))
+            ys.append(float(len([a for a in attempts if a[0] != -1])) / float(len(attempts)))
+        plt.plot(xs, ys, marker="o", label=f)
+    plt.xlim(0, 1)
+    plt.ylim(0)
+    plt.xlabel("Effective fault rate")
+    plt.ylabel("Forgery success probability")
+    plt.legend(loc="lower right", title="q")
+    plt.grid()
+    plt.show()
+
+
 try:
     readings = []
     total = 0
 
     with open("singleAttackStats.csv", "r") as results:
         for line in results:
-            reading = int(line.strip())
+            reading = int(line.strip().split(",")[0])
             total += 1
             if reading != -1:
                 readings.append(reading)
@@ -64,7 +85,7 @@ try:
 
     with open("parallelAttackStats.csv", "r") as results:
         for line in results:
-            faults, reading = list(map(int, line.strip().split(",")))
+            faults, reading = list(map(int, line.strip().split(",")[:2]))
             if faults not in readings:
                 readings[faults] = []
                 totals[faults] = 0
@@ -76,3 +97,20 @@ try:
 except IOError as e:
     print("Error reading results 2")
     print(e)
+
+# runs with -probability below 1 have it as a suffix, faults from every file are grouped by q then fault probability
+readings = {}
+for filename in glob.glob("parallelAttackStats*-p*.csv") + glob.glob("parallelAttackStats.csv"):
+    with open(filename, "r") as results:
+        for line in results:
+            columns = line.strip().split(",")
+            if len(columns) < 5:
+                continue  # written before the fault probability was recorded
+            faults, reading = int(columns[0]), int(columns[1])
+            probability, rate = float(columns[2]), float(columns[3])
+            readings.setdefault(faults, {}).setdefault(probability, []).append((reading, rate))
+
+if readings:
+    graph3(readings)
+else:
+    print("No results for graph 3")
@@ -0,0 +1,59 @@
+package fors
+
+import (
+	"github.com/kasperdi/SPHINCSPLUS-golang/address"
+	"github.com/kasperdi/SPHINCSPLUS-golang/parameters"
+	"math"
+)
+
+// Fors_treeRoot computes the root of FORS tree i from a secret leaf at the given index and its AUTH path
+func Fors_treeRoot(params *parameters.Parameters, sk []byte, auth []byte, i int, index int, PKseed []byte, adrs *address.ADRS) []byte {
+	adrs.SetTreeHeight(0)
+	adrs.SetTreeIndex(i*params.T + index)
+
+	node0 := params.Tweak.F(PKseed, adrs, sk)
+	var node1 []byte
+
+	for j := 0; j < params.A; j++ {
+		adrs.SetTreeHeight(j + 1)
+
+		if int(math.Floor(float64(index)/math.Pow(2, float64(j))))%2 == 0 {
+			adrs.SetTreeIndex(adrs.GetTreeIndex() / 2)
+
+			bytesToHash := make([]byte, params.N+len(node0))
+			copy(bytesToHash, node0)
+			copy(bytesToHash[params.N:], auth[j*params.N:(j+1)*params.N])
+
+			node1 = params.Tweak.H(PKseed, adrs, bytesToHash)
+		} else {
+			adrs.SetTreeIndex((adrs.GetTreeIndex() - 1) / 2)
+
+			bytesToHash := make([]byte, params.N+len(node0))
+			copy(bytesToHash, auth[j*params.N:(j+1)*params.N])
+			copy(bytesToHash[params.N:], node0)
+
+			node1 = params.Tweak.H(PKseed, adrs, bytesToHash)
+		}
+
+		node0 = node1
+	}
+	return node0
+}
+
+// MessageToIndices returns the index of the secret leaf revealed in each FORS tree when signing M
+func MessageToIndices(params *parameters.Parameters, M []byte) []int {
+	return message_to_indices(M, params.K, params.A)
+}
+
+// IndicesToMessage is the inverse of MessageToIndices, packing the indices into a FORS message
+func IndicesToMessage(params *parameters.Parameters, indices []int) []byte {
+	M := make([]byte, (params.K*params.A+7)/8)
+	offset := 0
+	for i := 0; i < params.K; i++ {
+		for j := 0; j < params.A; j++ {
+			M[offset>>3] |= byte((indices[i]>>j)&0x1) << (offset & 0x7)
+			offset++
+		}
+	}
+	return M
+}
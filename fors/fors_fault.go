@@ -0,0 +1,37 @@
+package fors
+
+import (
+	"github.com/kasperdi/SPHINCSPLUS-golang/address"
+	"github.com/kasperdi/SPHINCSPLUS-golang/parameters"
+	"math"
+)
+
+// IndexFault is called with each FORS tree and the index computed for it by message_to_indices, returning the index
+// actually used to pick the secret leaf and its AUTH path
+type IndexFault func(tree int, index int) int
+
+// Fors_sign_fault signs M as in Fors_sign, letting indexFault corrupt the index used in each tree
+func Fors_sign_fault(params *parameters.Parameters, M []byte, SKseed []byte, PKseed []byte, adrs *address.ADRS, indexFault IndexFault) *FORSSignature {
+	// compute signature elements
+	SIG_FORS := new(FORSSignature)
+
+	for i := 0; i < params.K; i++ {
+		// get next index
+		indices := message_to_indices(M, params.K, params.A)
+		index := indexFault(i, indices[i])
+
+		// pick private key element
+		adrs.SetTreeHeight(0)
+		adrs.SetTreeIndex(i*params.T + index)
+		PKElement := params.Tweak.PRF(SKseed, adrs)
+
+		AUTH := make([]byte, params.A*params.N)
+		for j := 0; j < params.A; j++ {
+			s := int(math.Floor(float64(index)/math.Pow(2, float64(j)))) ^ 1
+			copy(AUTH[j*params.N:], Fors_treehash(params, SKseed, i*params.T+s*int(math.Pow(2, float64(j))), j, PKseed, adrs))
+		}
+
+		SIG_FORS.Forspkauth = append(SIG_FORS.Forspkauth, &TreePKAUTH{PKElement, AUTH})
+	}
+	return SIG_FORS
+}
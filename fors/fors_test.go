@@ -6,6 +6,7 @@ import (
 	"encoding/hex"
 	"fmt"
 	"io/ioutil"
+	"reflect"
 	"testing"
 
 	"github.com/kasperdi/SPHINCSPLUS-golang/address"
@@ -148,3 +149,41 @@ func TestForsTreehashWrongArgs(t *testing.T) {
 		t.Errorf("Expected nil as StartIndex + Steps > W-1, but got different result")
 	}
 }
+
+// Tests that a faulty index reveals a leaf which signs a different FORS message under the same key.
+func TestSignFaultIndex(t *testing.T) {
+	params := parameters.MakeSphincsPlusSHA256128fRobust(false)
+	message := make([]byte, (params.K*params.A+7)/8)
+	rand.Read(message)
+	SKseed := make([]byte, params.N)
+	rand.Read(SKseed)
+	PKseed := make([]byte, params.N)
+	rand.Read(PKseed)
+	var adrs address.ADRS
+	adrs.SetType(address.FORS_TREE)
+
+	PK := Fors_PKgen(params, SKseed, PKseed, &adrs)
+	indices := MessageToIndices(params, message)
+	if !reflect.DeepEqual(MessageToIndices(params, IndicesToMessage(params, indices)), indices) {
+		t.Fatalf("IndicesToMessage isn't the inverse of MessageToIndices")
+	}
+
+	signature := Fors_sign_fault(params, message, SKseed, PKseed, &adrs, func(tree int, index int) int {
+		if tree == 3 {
+			return index ^ 1
+		}
+		return index
+	})
+	if bytes.Equal(Fors_pkFromSig(params, signature, message, PKseed, &adrs), PK) {
+		t.Errorf("Verification of the faulty signature succeeded, but was expected to fail!")
+	}
+
+	indices[3] ^= 1
+	if !bytes.Equal(Fors_pkFromSig(params, signature, IndicesToMessage(params, indices), PKseed, &adrs), PK) {
+		t.Errorf("The faulty signature didn't sign the message with the faulty index")
+	}
+	root := Fors_treeRoot(params, signature.GetSK(3), signature.GetAUTH(3), 3, indices[3], PKseed, &adrs)
+	if !bytes.Equal(root, Fors_treehash(params, SKseed, 3*params.T, params.A, PKseed, &adrs)) {
+		t.Errorf("Fors_treeRoot didn't compute the root of the faulted tree")
+	}
+}
@@ -2,10 +2,12 @@ module github.com/kasperdi/SPHINCSPLUS-golang
 
 go 1.18
 
-require golang.org/x/crypto v0.0.0-20220518034528-6f7dac969898
+require (
+	github.com/fatih/color v1.17.0
+	golang.org/x/crypto v0.0.0-20220518034528-6f7dac969898
+)
 
 require (
-	github.com/fatih/color v1.17.0 // indirect
 	github.com/mattn/go-colorable v0.1.13 // indirect
 	github.com/mattn/go-isatty v0.0.20 // indirect
 	golang.org/x/sys v0.18.0 // indirect
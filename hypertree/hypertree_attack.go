@@ -7,7 +7,8 @@ import (
 	"github.com/kasperdi/SPHINCSPLUS-golang/xmss"
 )
 
-func Ht_verify_get_msg_sig(params *parameters.Parameters, M []byte, SIG_HT *HTSignature, PKseed []byte, idx_tree uint64, idx_leaf int, PK_HT []byte) (bool, []byte, []byte) {
+// Ht_verify_get_msg_sig verifies SIG_HT and returns the message and WOTS signature used in the given layer
+func Ht_verify_get_msg_sig(params *parameters.Parameters, M []byte, SIG_HT *HTSignature, PKseed []byte, idx_tree uint64, idx_leaf int, PK_HT []byte, layer int) (bool, []byte, []byte) {
 	// init
 	adrs := new(address.ADRS)
 
@@ -15,10 +16,11 @@ func Ht_verify_get_msg_sig(params *parameters.Parameters, M []byte, SIG_HT *HTSi
 	SIG_tmp := SIG_HT.GetXMSSSignature(0)
 	adrs.SetLayerAddress(0)
 	adrs.SetTreeAddress(idx_tree)
-	node := xmss.Xmss_pkFromSig(params, idx_leaf, SIG_tmp, M, PKseed, adrs)
 
-	var msg []byte
-	var sig []byte
+	msg := M
+	sig := SIG_tmp.GetWOTSSig()
+
+	node := xmss.Xmss_pkFromSig(params, idx_leaf, SIG_tmp, M, PKseed, adrs)
 
 	for j := 1; j < params.D; j++ {
 		idx_leaf = int(idx_tree % (1 << uint64(params.H/params.D)))
@@ -26,10 +28,36 @@ func Ht_verify_get_msg_sig(params *parameters.Parameters, M []byte, SIG_HT *HTSi
 		SIG_tmp = SIG_HT.GetXMSSSignature(j)
 		adrs.SetLayerAddress(j)
 		adrs.SetTreeAddress(idx_tree)
-		sig = SIG_tmp.GetWOTSSig()
-		msg = node
+		if j == layer {
+			sig = SIG_tmp.GetWOTSSig()
+			msg = node
+		}
 		node = xmss.Xmss_pkFromSig(params, idx_leaf, SIG_tmp, node, PKseed, adrs)
 	}
 
 	return bytes.Equal(node, PK_HT), msg, sig
 }
+
+// Ht_verify_get_msgs verifies SIG_HT and returns the message signed in every layer, starting with M in layer 0
+func Ht_verify_get_msgs(params *parameters.Parameters, M []byte, SIG_HT *HTSignature, PKseed []byte, idx_tree uint64, idx_leaf int, PK_HT []byte) (bool, [][]byte) {
+	// init
+	adrs := new(address.ADRS)
+	msgs := make([][]byte, params.D)
+
+	// verify
+	adrs.SetLayerAddress(0)
+	adrs.SetTreeAddress(idx_tree)
+	msgs[0] = M
+	node := xmss.Xmss_pkFromSig(params, idx_leaf, SIG_HT.GetXMSSSignature(0), M, PKseed, adrs)
+
+	for j := 1; j < params.D; j++ {
+		idx_leaf = int(idx_tree % (1 << uint64(params.H/params.D)))
+		idx_tree = idx_tree >> (params.H / params.D)
+		adrs.SetLayerAddress(j)
+		adrs.SetTreeAddress(idx_tree)
+		msgs[j] = node
+		node = xmss.Xmss_pkFromSig(params, idx_leaf, SIG_HT.GetXMSSSignature(j), node, PKseed, adrs)
+	}
+
+	return bytes.Equal(node, PK_HT), msgs
+}
@@ -6,14 +6,20 @@ import (
 	"github.com/kasperdi/SPHINCSPLUS-golang/xmss"
 )
 
-func Ht_sign_debug(params *parameters.Parameters, M []byte, SKseed []byte, PKseed []byte, idx_tree uint64, idx_leaf int) *HTSignature {
+// Ht_sign_debug signs M as in Ht_sign, printing the WOTS secret key used in debugLayer
+func Ht_sign_debug(params *parameters.Parameters, M []byte, SKseed []byte, PKseed []byte, idx_tree uint64, idx_leaf int, debugLayer int) *HTSignature {
 	// init
 	adrs := new(address.ADRS)
 
 	// sign
 	adrs.SetLayerAddress(0)
 	adrs.SetTreeAddress(idx_tree)
-	SIG_tmp := xmss.Xmss_sign(params, M, SKseed, idx_leaf, PKseed, adrs)
+	var SIG_tmp *xmss.XMSSSignature
+	if debugLayer == 0 {
+		SIG_tmp = xmss.Xmss_sign_debug(params, M, SKseed, idx_leaf, PKseed, adrs)
+	} else {
+		SIG_tmp = xmss.Xmss_sign(params, M, SKseed, idx_leaf, PKseed, adrs)
+	}
 	SIG_HT := make([]*xmss.XMSSSignature, 0)
 	SIG_HT = append(SIG_HT, SIG_tmp)
 	root := xmss.Xmss_pkFromSig(params, idx_leaf, SIG_tmp, M, PKseed, adrs)
@@ -24,7 +30,11 @@ func Ht_sign_debug(params *parameters.Parameters, M []byte, SKseed []byte, PKsee
 		idx_tree = idx_tree >> (params.H / params.D)
 		adrs.SetLayerAddress(j)
 		adrs.SetTreeAddress(idx_tree)
-		SIG_tmp = xmss.Xmss_sign_debug(params, root, SKseed, idx_leaf, PKseed, adrs)
+		if j == debugLayer {
+			SIG_tmp = xmss.Xmss_sign_debug(params, root, SKseed, idx_leaf, PKseed, adrs)
+		} else {
+			SIG_tmp = xmss.Xmss_sign(params, root, SKseed, idx_leaf, PKseed, adrs)
+		}
 		SIG_HT = append(SIG_HT, SIG_tmp)
 		if j < params.D-1 {
 			root = xmss.Xmss_pkFromSig(params, idx_leaf, SIG_tmp, root, PKseed, adrs)
@@ -1,23 +1,402 @@
 package hypertree
 
 import (
+	"bytes"
 	"github.com/kasperdi/SPHINCSPLUS-golang/address"
 	"github.com/kasperdi/SPHINCSPLUS-golang/parameters"
+	"github.com/kasperdi/SPHINCSPLUS-golang/tweakable"
+	"github.com/kasperdi/SPHINCSPLUS-golang/util"
+	"github.com/kasperdi/SPHINCSPLUS-golang/wots"
 	"github.com/kasperdi/SPHINCSPLUS-golang/xmss"
 	mathrand "math/rand"
 )
 
-func Ht_sign_fault(params *parameters.Parameters, M []byte, SKseed []byte, PKseed []byte, idx_tree uint64, idx_leaf int) *HTSignature {
+// FaultModel decides how a signature is corrupted while the hypertree is being constructed.
+// Fault is called for every layer straight after its XMSS signature has been computed, with the
+// tree and leaf index used at that layer and the root (message) the layer signs. It may mutate
+// SIG_XMSS in place; faults on layers below D-1 also change the root passed to the layer above.
+type FaultModel interface {
+	Fault(params *parameters.Parameters, layer int, idxTree uint64, idxLeaf int, SIG_XMSS *xmss.XMSSSignature, root []byte)
+}
+
+// BitFlipFault randomly flips up to MaxBits bits in the XMSS signature of layer Layer, or up to 64 if MaxBits is 0.
+// As in the original fault, the loop bound is redrawn below MaxBits after every flip, so few bits are flipped far more
+// often than many; this keeps the stats in data/ reproducible. If Magnitude is set it draws the number of bits
+// flipped once instead. Bits are chosen using Rand, or the global math/rand source if Rand is nil.
+type BitFlipFault struct {
+	MaxBits   int
+	Layer     int
+	Magnitude Magnitude
+	Rand      *mathrand.Rand
+}
+
+// Magnitude draws the number of bits flipped by a fault, using r or the global math/rand source if r is nil
+type Magnitude func(r *mathrand.Rand) int
+
+// FixedMagnitude always flips the same number of bits
+func FixedMagnitude(bits int) Magnitude {
+	return func(r *mathrand.Rand) int {
+		return bits
+	}
+}
+
+// UniformMagnitude flips between 1 and max bits, all equally likely
+func UniformMagnitude(max int) Magnitude {
+	return func(r *mathrand.Rand) int {
+		return 1 + util.Intn(r, max)
+	}
+}
+
+// GeometricMagnitude flips at least one bit, with every further bit flipped with probability 1-p
+func GeometricMagnitude(p float64) Magnitude {
+	return func(r *mathrand.Rand) int {
+		bits := 1
+		for util.Float64(r) >= p {
+			bits++
+		}
+		return bits
+	}
+}
+
+// DefaultFaultModel returns the fault described in the README, flipping up to 64 bits of layer D-2
+func DefaultFaultModel(params *parameters.Parameters) FaultModel {
+	return &BitFlipFault{MaxBits: 64, Layer: params.D - 2}
+}
+
+func (f *BitFlipFault) Fault(params *parameters.Parameters, layer int, idxTree uint64, idxLeaf int, SIG_XMSS *xmss.XMSSSignature, root []byte) {
+	// cause fault in the target tree by mutating the bits of SIG_XMSS
+	if layer != f.Layer {
+		return
+	}
+	if f.Magnitude != nil {
+		bits := f.Magnitude(f.Rand)
+		for i := 0; i < bits; i++ {
+			f.flipBit(SIG_XMSS)
+		}
+		return
+	}
+	maxBits := f.MaxBits
+	if maxBits == 0 {
+		maxBits = 64
+	}
+	for i := 0; i < util.Intn(f.Rand, maxBits); i++ {
+		f.flipBit(SIG_XMSS)
+	}
+}
+
+// flipBit flips a random bit of SIG_XMSS
+func (f *BitFlipFault) flipBit(SIG_XMSS *xmss.XMSSSignature) {
+	targetBit := util.Intn(f.Rand, 8*(len(SIG_XMSS.AUTH)+len(SIG_XMSS.WotsSignature)))
+	if targetBit >= 8*len(SIG_XMSS.AUTH) {
+		// flip (targetBit - 8*len(SIG_XMSS.AUTH)) bit of SIG_XMSS.WotsSignature
+		targetBit -= 8 * len(SIG_XMSS.AUTH)
+		SIG_XMSS.WotsSignature[targetBit>>3] ^= 1 << (targetBit % 8)
+	} else {
+		// flip targetBit of SIG_XMSS.AUTH
+		SIG_XMSS.AUTH[targetBit>>3] ^= 1 << (targetBit % 8)
+	}
+}
+
+// ChainFaultModel is implemented by fault models which corrupt the WOTS chain computation itself rather than the
+// finished signature. ChainFault is called before each layer is signed and returns nil to sign it correctly.
+type ChainFaultModel interface {
+	FaultModel
+	ChainFault(params *parameters.Parameters, layer int, idxTree uint64, idxLeaf int) wots.ChainFault
+}
+
+// ChainSkipFault skips Skips consecutive F iterations, starting at a random iteration, of one randomly chosen WOTS
+// chain while signing layer Layer. With Abort set every iteration from the random start onwards is skipped instead,
+// so the chain stops early and leaks a value further down the same hash chain.
+type ChainSkipFault struct {
+	Skips int
+	Layer int
+	Abort bool
+	Rand  *mathrand.Rand
+}
+
+// Fault does nothing as the chain has already been corrupted while signing
+func (f *ChainSkipFault) Fault(params *parameters.Parameters, layer int, idxTree uint64, idxLeaf int, SIG_XMSS *xmss.XMSSSignature, root []byte) {
+}
+
+func (f *ChainSkipFault) ChainFault(params *parameters.Parameters, layer int, idxTree uint64, idxLeaf int) wots.ChainFault {
+	if layer != f.Layer {
+		return nil
+	}
+	targetChain := util.Intn(f.Rand, params.Len)
+	return func(chainIdx int, steps int) (int, int) {
+		if chainIdx != targetChain || steps == 0 {
+			return steps, 0
+		}
+		if f.Abort {
+			skipFrom := util.Intn(f.Rand, steps)
+			return skipFrom, steps - skipFrom
+		}
+		skips := f.Skips
+		if skips > steps {
+			skips = steps
+		}
+		return util.Intn(f.Rand, steps-skips+1), skips
+	}
+}
+
+// RootFaultModel is implemented by fault models which corrupt the computation of a subtree root inside Ht_sign, as
+// in the fault model of Genêt et al. RootFault is called before the root of each layer below D-1 is computed and
+// returns nil to compute it correctly. The signatures of the faulted layer and below are left untouched.
+type RootFaultModel interface {
+	FaultModel
+	RootFault(params *parameters.Parameters, layer int, idxTree uint64, idxLeaf int) xmss.NodeFault
+}
+
+// SubtreeRootFault replaces the node at height Height, on the path from the WOTS leaf to the root of layer Layer,
+// with a random value. Height 0 faults the leaf's WOTS pk, 1 to Hprime-1 an internal node and Hprime the root itself.
+type SubtreeRootFault struct {
+	Height int
+	Layer  int
+	Rand   *mathrand.Rand
+}
+
+// Fault does nothing as the signature itself is never changed
+func (f *SubtreeRootFault) Fault(params *parameters.Parameters, layer int, idxTree uint64, idxLeaf int, SIG_XMSS *xmss.XMSSSignature, root []byte) {
+}
+
+func (f *SubtreeRootFault) RootFault(params *parameters.Parameters, layer int, idxTree uint64, idxLeaf int) xmss.NodeFault {
+	if layer != f.Layer {
+		return nil
+	}
+	return func(height int, node []byte) {
+		if height != f.Height {
+			return
+		}
+		for i := range node {
+			node[i] = byte(util.Intn(f.Rand, 256))
+		}
+	}
+}
+
+// TweakFaultModel is implemented by fault models which corrupt the tweakable hash calls made while signing a layer.
+// LayerTweak is called before each layer is signed and returns the hash function to sign it with, or nil to use
+// params.Tweak.
+type TweakFaultModel interface {
+	FaultModel
+	LayerTweak(params *parameters.Parameters, layer int, idxTree uint64, idxLeaf int) tweakable.TweakableHashFunction
+}
+
+// ADRS words which can be corrupted by AddressFault
+const (
+	LayerWord   = "layer"
+	TreeWord    = "tree"
+	KeyPairWord = "keypair"
+	ChainWord   = "chain"
+	HashWord    = "hash"
+)
+
+// AddressFault flips a random bit of the ADRS word Word in the tweakable hash calls made while signing layer Layer.
+// Call is the single call corrupted, counting the calls which take an address from 0 (including those computing AUTH).
+// A negative Call corrupts the same bit in every call of the XMSS signature.
+type AddressFault struct {
+	Word  string
+	Layer int
+	Call  int
+	Rand  *mathrand.Rand
+}
+
+// Fault does nothing as the signature has already been corrupted while signing
+func (f *AddressFault) Fault(params *parameters.Parameters, layer int, idxTree uint64, idxLeaf int, SIG_XMSS *xmss.XMSSSignature, root []byte) {
+}
+
+func (f *AddressFault) LayerTweak(params *parameters.Parameters, layer int, idxTree uint64, idxLeaf int) tweakable.TweakableHashFunction {
+	if layer != f.Layer {
+		return nil
+	}
+	bit := util.Intn(f.Rand, 8*len(addressWord(new(address.ADRS), f.Word)))
+	call := 0
+	return &tweakable.AddressFaultTweak{Tweak: params.Tweak, Corrupt: func(adrs *address.ADRS) {
+		if f.Call < 0 || call == f.Call {
+			word := addressWord(adrs, f.Word)
+			word[bit>>3] ^= 1 << (bit % 8)
+		}
+		call++
+	}}
+}
+
+// addressWord returns the bytes of adrs holding the given word
+func addressWord(adrs *address.ADRS, word string) []byte {
+	switch word {
+	case LayerWord:
+		return adrs.LayerAddress[:]
+	case TreeWord:
+		return adrs.TreeAddress[:]
+	case KeyPairWord:
+		return adrs.KeyPairAddress[:]
+	case ChainWord:
+		return adrs.ChainAddress[:]
+	case HashWord:
+		return adrs.HashAddress[:]
+	}
+	panic("unknown ADRS word " + word)
+}
+
+// MultiFault injects every one of Faults into the same signature, e.g. bit flips in several layers at once. Chain,
+// root and tweak faults are taken from the first of Faults returning one for the layer being signed.
+type MultiFault struct {
+	Faults []FaultModel
+}
+
+func (f *MultiFault) Fault(params *parameters.Parameters, layer int, idxTree uint64, idxLeaf int, SIG_XMSS *xmss.XMSSSignature, root []byte) {
+	for _, fault := range f.Faults {
+		fault.Fault(params, layer, idxTree, idxLeaf, SIG_XMSS, root)
+	}
+}
+
+func (f *MultiFault) ChainFault(params *parameters.Parameters, layer int, idxTree uint64, idxLeaf int) wots.ChainFault {
+	for _, fault := range f.Faults {
+		if chainFaultModel, ok := fault.(ChainFaultModel); ok {
+			if chainFault := chainFaultModel.ChainFault(params, layer, idxTree, idxLeaf); chainFault != nil {
+				return chainFault
+			}
+		}
+	}
+	return nil
+}
+
+func (f *MultiFault) RootFault(params *parameters.Parameters, layer int, idxTree uint64, idxLeaf int) xmss.NodeFault {
+	for _, fault := range f.Faults {
+		if rootFaultModel, ok := fault.(RootFaultModel); ok {
+			if nodeFault := rootFaultModel.RootFault(params, layer, idxTree, idxLeaf); nodeFault != nil {
+				return nodeFault
+			}
+		}
+	}
+	return nil
+}
+
+func (f *MultiFault) LayerTweak(params *parameters.Parameters, layer int, idxTree uint64, idxLeaf int) tweakable.TweakableHashFunction {
+	for _, fault := range f.Faults {
+		if tweakFaultModel, ok := fault.(TweakFaultModel); ok {
+			if tweak := tweakFaultModel.LayerTweak(params, layer, idxTree, idxLeaf); tweak != nil {
+				return tweak
+			}
+		}
+	}
+	return nil
+}
+
+// RandomLayerFault injects one of Faults into every signature, drawn with probabilities proportional to Weights, or
+// all equally likely if Weights is nil. With each of Faults targeting its own layer this spreads the faults over
+// several layers. Faults are drawn using Rand, or the global math/rand source if Rand is nil.
+type RandomLayerFault struct {
+	Faults  []FaultModel
+	Weights []float64
+	Rand    *mathrand.Rand
+
+	current   FaultModel
+	lastLayer int
+}
+
+// pick returns the fault drawn for the signature being signed. Layer 0 is signed first, so a new fault is drawn
+// whenever layer 0 follows a higher layer
+func (f *RandomLayerFault) pick(layer int) FaultModel {
+	if f.current == nil || layer == 0 && f.lastLayer != 0 {
+		f.current = f.Faults[f.draw()]
+	}
+	f.lastLayer = layer
+	return f.current
+}
+
+func (f *RandomLayerFault) draw() int {
+	if f.Weights == nil {
+		return util.Intn(f.Rand, len(f.Faults))
+	}
+	total := 0.0
+	for _, weight := range f.Weights {
+		total += weight
+	}
+	x := util.Float64(f.Rand) * total
+	for i, weight := range f.Weights {
+		if x < weight {
+			return i
+		}
+		x -= weight
+	}
+	return len(f.Weights) - 1
+}
+
+func (f *RandomLayerFault) Fault(params *parameters.Parameters, layer int, idxTree uint64, idxLeaf int, SIG_XMSS *xmss.XMSSSignature, root []byte) {
+	f.pick(layer).Fault(params, layer, idxTree, idxLeaf, SIG_XMSS, root)
+}
+
+func (f *RandomLayerFault) ChainFault(params *parameters.Parameters, layer int, idxTree uint64, idxLeaf int) wots.ChainFault {
+	if chainFaultModel, ok := f.pick(layer).(ChainFaultModel); ok {
+		return chainFaultModel.ChainFault(params, layer, idxTree, idxLeaf)
+	}
+	return nil
+}
+
+func (f *RandomLayerFault) RootFault(params *parameters.Parameters, layer int, idxTree uint64, idxLeaf int) xmss.NodeFault {
+	if rootFaultModel, ok := f.pick(layer).(RootFaultModel); ok {
+		return rootFaultModel.RootFault(params, layer, idxTree, idxLeaf)
+	}
+	return nil
+}
+
+func (f *RandomLayerFault) LayerTweak(params *parameters.Parameters, layer int, idxTree uint64, idxLeaf int) tweakable.TweakableHashFunction {
+	if tweakFaultModel, ok := f.pick(layer).(TweakFaultModel); ok {
+		return tweakFaultModel.LayerTweak(params, layer, idxTree, idxLeaf)
+	}
+	return nil
+}
+
+// FaultReport is the ground truth of what a fault model did to a hypertree signature. It is meant for the
+// experimenter only and must never be handed to the attacker.
+type FaultReport struct {
+	Layers []*LayerFaultReport
+}
+
+// LayerFaultReport records the changes made to the XMSS signature of a single layer
+type LayerFaultReport struct {
+	Layer    int
+	IdxTree  uint64
+	IdxLeaf  int
+	AuthBits []int // positions of the bits flipped in AUTH
+	WotsBits []int // positions of the bits flipped in WotsSignature
+	// whether the root computed from the faulty signature differs from the correct one
+	RootChanged bool
+}
+
+// Faulted returns true if any layer of the signature was changed
+func (r *FaultReport) Faulted() bool {
+	return len(r.Layers) > 0
+}
+
+// Layer returns the report for the given layer, or nil if it wasn't faulted
+func (r *FaultReport) Layer(layer int) *LayerFaultReport {
+	for _, l := range r.Layers {
+		if l.Layer == layer {
+			return l
+		}
+	}
+	return nil
+}
+
+func Ht_sign_fault(params *parameters.Parameters, M []byte, SKseed []byte, PKseed []byte, idx_tree uint64, idx_leaf int, faultModel FaultModel) *HTSignature {
+	SIG_HT, _ := Ht_sign_fault_report(params, M, SKseed, PKseed, idx_tree, idx_leaf, faultModel)
+	return SIG_HT
+}
+
+// Ht_sign_fault_report signs M as in Ht_sign_fault and also reports every change the fault model made
+func Ht_sign_fault_report(params *parameters.Parameters, M []byte, SKseed []byte, PKseed []byte, idx_tree uint64, idx_leaf int, faultModel FaultModel) (*HTSignature, *FaultReport) {
 	// init
 	adrs := new(address.ADRS)
+	report := new(FaultReport)
 
 	// sign
 	adrs.SetLayerAddress(0)
 	adrs.SetTreeAddress(idx_tree)
-	SIG_tmp := xmss.Xmss_sign(params, M, SKseed, idx_leaf, PKseed, adrs)
+	SIG_tmp, correct := signLayer(params, faultModel, 0, idx_tree, idx_leaf, M, SKseed, PKseed, adrs)
+	faultAndReport(params, faultModel, 0, idx_tree, idx_leaf, SIG_tmp, correct, M, PKseed, adrs, report)
 	SIG_HT := make([]*xmss.XMSSSignature, 0)
 	SIG_HT = append(SIG_HT, SIG_tmp)
-	root := xmss.Xmss_pkFromSig(params, idx_leaf, SIG_tmp, M, PKseed, adrs)
+	root := computeRoot(params, faultModel, 0, idx_tree, idx_leaf, SIG_tmp, M, PKseed, adrs, report)
 	for j := 1; j < params.D; j++ {
 		// Set idx_leaf to be the (h / d) least significant bits of idx_tree
 		idx_leaf = int(idx_tree % (1 << uint64(params.H/params.D)))
@@ -26,33 +405,102 @@ func Ht_sign_fault(params *parameters.Parameters, M []byte, SKseed []byte, PKsee
 		adrs.SetLayerAddress(j)
 		adrs.SetTreeAddress(idx_tree)
 
-		SIG_tmp = xmss.Xmss_sign(params, root, SKseed, idx_leaf, PKseed, adrs)
+		SIG_tmp, correct = signLayer(params, faultModel, j, idx_tree, idx_leaf, root, SKseed, PKseed, adrs)
 
-		// cause fault in second to last tree by mutating the bits of SIG_tmp
-		if j == params.D-2 {
-			fault(SIG_tmp)
-		}
+		// let the fault model mutate the signature before it is used to compute the next root
+		faultAndReport(params, faultModel, j, idx_tree, idx_leaf, SIG_tmp, correct, root, PKseed, adrs, report)
 
 		SIG_HT = append(SIG_HT, SIG_tmp)
 		if j < params.D-1 {
-			root = xmss.Xmss_pkFromSig(params, idx_leaf, SIG_tmp, root, PKseed, adrs)
+			root = computeRoot(params, faultModel, j, idx_tree, idx_leaf, SIG_tmp, root, PKseed, adrs, report)
 		}
 	}
 
-	return &HTSignature{SIG_HT}
+	return &HTSignature{SIG_HT}, report
 }
 
-// given a signature randomly flip up to 64 bits
-func fault(SIG_tmp *xmss.XMSSSignature) {
-	for i := 0; i < mathrand.Intn(64); i++ {
-		targetBit := mathrand.Intn(8 * (len(SIG_tmp.AUTH) + len(SIG_tmp.WotsSignature)))
-		if targetBit >= 8*len(SIG_tmp.AUTH) {
-			// flip (targetBit - 8*len(SIG_tmp.AUTH)) bit of SIG_tmp.WotsSignature
-			targetBit -= 8 * len(SIG_tmp.AUTH)
-			SIG_tmp.WotsSignature[targetBit>>3] ^= 1 << (targetBit % 8)
-		} else {
-			// flip targetBit of SIG_tmp.AUTH
-			SIG_tmp.AUTH[targetBit>>3] ^= 1 << (targetBit % 8)
+// signLayer computes the XMSS signature of a single layer, letting a ChainFaultModel corrupt the WOTS chains or a
+// TweakFaultModel the hash calls. It also returns a copy of the correct signature to compare against.
+func signLayer(params *parameters.Parameters, faultModel FaultModel, layer int, idxTree uint64, idxLeaf int,
+	M []byte, SKseed []byte, PKseed []byte, adrs *address.ADRS) (*xmss.XMSSSignature, *xmss.XMSSSignature) {
+
+	if tweakFaultModel, ok := faultModel.(TweakFaultModel); ok {
+		if tweak := tweakFaultModel.LayerTweak(params, layer, idxTree, idxLeaf); tweak != nil {
+			faultyParams := *params
+			faultyParams.Tweak = tweak
+			correct := xmss.Xmss_sign(params, M, SKseed, idxLeaf, PKseed, adrs.Copy())
+			return xmss.Xmss_sign(&faultyParams, M, SKseed, idxLeaf, PKseed, adrs), correct
 		}
 	}
+
+	if chainFaultModel, ok := faultModel.(ChainFaultModel); ok {
+		if chainFault := chainFaultModel.ChainFault(params, layer, idxTree, idxLeaf); chainFault != nil {
+			SIG_XMSS := xmss.Xmss_sign_fault(params, M, SKseed, idxLeaf, PKseed, adrs, chainFault)
+			correct := &xmss.XMSSSignature{
+				WotsSignature: wots.Wots_sign(params, M, SKseed, PKseed, adrs.Copy()),
+				AUTH:          append([]byte(nil), SIG_XMSS.AUTH...),
+			}
+			return SIG_XMSS, correct
+		}
+	}
+
+	SIG_XMSS := xmss.Xmss_sign(params, M, SKseed, idxLeaf, PKseed, adrs)
+	correct := &xmss.XMSSSignature{
+		WotsSignature: append([]byte(nil), SIG_XMSS.WotsSignature...),
+		AUTH:          append([]byte(nil), SIG_XMSS.AUTH...),
+	}
+	return SIG_XMSS, correct
+}
+
+// computeRoot computes the root signed by the layer above, letting a RootFaultModel corrupt its computation. A changed
+// root is added to the report of the layer
+func computeRoot(params *parameters.Parameters, faultModel FaultModel, layer int, idxTree uint64, idxLeaf int,
+	SIG_XMSS *xmss.XMSSSignature, M []byte, PKseed []byte, adrs *address.ADRS, report *FaultReport) []byte {
+
+	root := xmss.Xmss_pkFromSig(params, idxLeaf, SIG_XMSS, M, PKseed, adrs)
+	rootFaultModel, ok := faultModel.(RootFaultModel)
+	if !ok {
+		return root
+	}
+	nodeFault := rootFaultModel.RootFault(params, layer, idxTree, idxLeaf)
+	if nodeFault == nil {
+		return root
+	}
+
+	faultyRoot := xmss.Xmss_pkFromSig_fault(params, idxLeaf, SIG_XMSS, M, PKseed, adrs, nodeFault)
+	if !bytes.Equal(root, faultyRoot) {
+		layerReport := report.Layer(layer)
+		if layerReport == nil {
+			layerReport = &LayerFaultReport{Layer: layer, IdxTree: idxTree, IdxLeaf: idxLeaf, AuthBits: []int{}, WotsBits: []int{}}
+			report.Layers = append(report.Layers, layerReport)
+		}
+		layerReport.RootChanged = true
+	}
+	return faultyRoot
+}
+
+// faultAndReport applies the fault model to a single layer and compares the result against the correct signature,
+// adding a layer report if anything was changed
+func faultAndReport(params *parameters.Parameters, faultModel FaultModel, layer int, idxTree uint64, idxLeaf int,
+	SIG_XMSS *xmss.XMSSSignature, correct *xmss.XMSSSignature, root []byte, PKseed []byte, adrs *address.ADRS, report *FaultReport) {
+
+	correctRoot := append([]byte(nil), root...)
+
+	faultModel.Fault(params, layer, idxTree, idxLeaf, SIG_XMSS, root)
+
+	layerReport := &LayerFaultReport{
+		Layer:    layer,
+		IdxTree:  idxTree,
+		IdxLeaf:  idxLeaf,
+		AuthBits: util.FlippedBits(correct.AUTH, SIG_XMSS.AUTH),
+		WotsBits: util.FlippedBits(correct.WotsSignature, SIG_XMSS.WotsSignature),
+	}
+	if len(layerReport.AuthBits) == 0 && len(layerReport.WotsBits) == 0 && bytes.Equal(correctRoot, root) {
+		return
+	}
+
+	correctNode := xmss.Xmss_pkFromSig(params, idxLeaf, correct, correctRoot, PKseed, adrs.Copy())
+	faultyNode := xmss.Xmss_pkFromSig(params, idxLeaf, SIG_XMSS, root, PKseed, adrs.Copy())
+	layerReport.RootChanged = !bytes.Equal(correctNode, faultyNode)
+	report.Layers = append(report.Layers, layerReport)
 }
@@ -3,9 +3,11 @@ package hypertree
 import (
 	"crypto/rand"
 	"fmt"
+	"reflect"
 	"testing"
 
 	"github.com/kasperdi/SPHINCSPLUS-golang/parameters"
+	"github.com/kasperdi/SPHINCSPLUS-golang/xmss"
 )
 
 // Runs the testSignAndVerify subtest for all 24 implemented Hypertree variants.
@@ -71,3 +73,313 @@ func testSignAndVerify(t *testing.T, params *parameters.Parameters) {
 	}
 
 }
+
+// recordingFault records the layers it was called on without mutating anything
+type recordingFault struct {
+	layers []int
+}
+
+func (f *recordingFault) Fault(params *parameters.Parameters, layer int, idxTree uint64, idxLeaf int, SIG_XMSS *xmss.XMSSSignature, root []byte) {
+	f.layers = append(f.layers, layer)
+}
+
+// Tests that a fault model is consulted once per layer and that a model which doesn't fault leaves the signature valid.
+func TestFaultModelCalledPerLayer(t *testing.T) {
+	params := parameters.MakeSphincsPlusSHA256128fRobust(false)
+	message := make([]byte, params.N)
+	rand.Read(message)
+	SKseed := make([]byte, params.N)
+	rand.Read(SKseed)
+	PKseed := make([]byte, params.N)
+	rand.Read(PKseed)
+
+	PK := Ht_PKgen(params, SKseed, PKseed)
+	faultModel := new(recordingFault)
+	signature := Ht_sign_fault(params, message, SKseed, PKseed, 5, 3, faultModel)
+
+	if len(faultModel.layers) != params.D {
+		t.Fatalf("Fault model called %d times, expected %d", len(faultModel.layers), params.D)
+	}
+	for i, layer := range faultModel.layers {
+		if layer != i {
+			t.Errorf("Fault model called on layer %d, expected %d", layer, i)
+		}
+	}
+	if !Ht_verify(params, message, signature, PKseed, 5, 3, PK) {
+		t.Errorf("Verification of signature without fault failed, but was expected to succeed!")
+	}
+}
+
+// Tests that the default fault model only changes the 2nd to last layer.
+func TestDefaultFaultModelLayer(t *testing.T) {
+	params := parameters.MakeSphincsPlusSHA256128fRobust(false)
+	message := make([]byte, params.N)
+	rand.Read(message)
+	SKseed := make([]byte, params.N)
+	rand.Read(SKseed)
+	PKseed := make([]byte, params.N)
+	rand.Read(PKseed)
+
+	signature := Ht_sign(params, message, SKseed, PKseed, 5, 3)
+	faultySignature := Ht_sign_fault(params, message, SKseed, PKseed, 5, 3, DefaultFaultModel(params))
+
+	for j := 0; j < params.D-2; j++ {
+		if !reflect.DeepEqual(signature.GetXMSSSignature(j), faultySignature.GetXMSSSignature(j)) {
+			t.Errorf("Layer %d was changed by the default fault model", j)
+		}
+	}
+}
+
+// Tests that a bit flip fault targeting a lower layer leaves the layers below it untouched.
+func TestBitFlipFaultLayer(t *testing.T) {
+	params := parameters.MakeSphincsPlusSHA256128fRobust(false)
+	message := make([]byte, params.N)
+	rand.Read(message)
+	SKseed := make([]byte, params.N)
+	rand.Read(SKseed)
+	PKseed := make([]byte, params.N)
+	rand.Read(PKseed)
+
+	signature := Ht_sign(params, message, SKseed, PKseed, 5, 3)
+	faultySignature := Ht_sign_fault(params, message, SKseed, PKseed, 5, 3, &BitFlipFault{MaxBits: 64, Layer: 4})
+
+	for j := 0; j < 4; j++ {
+		if !reflect.DeepEqual(signature.GetXMSSSignature(j), faultySignature.GetXMSSSignature(j)) {
+			t.Errorf("Layer %d was changed by a fault on layer 4", j)
+		}
+	}
+
+	// without MaxBits or Magnitude up to 64 bits are flipped
+	faultySignature = Ht_sign_fault(params, message, SKseed, PKseed, 5, 3, &BitFlipFault{Layer: 4})
+	if !reflect.DeepEqual(signature.GetXMSSSignature(0), faultySignature.GetXMSSSignature(0)) {
+		t.Errorf("Layer 0 was changed by a zero value fault on layer 4")
+	}
+}
+
+// Tests that the fault report matches the bits that actually differ from the correct signature.
+func TestFaultReport(t *testing.T) {
+	params := parameters.MakeSphincsPlusSHA256128fRobust(false)
+	message := make([]byte, params.N)
+	rand.Read(message)
+	SKseed := make([]byte, params.N)
+	rand.Read(SKseed)
+	PKseed := make([]byte, params.N)
+	rand.Read(PKseed)
+
+	_, report := Ht_sign_fault_report(params, message, SKseed, PKseed, 5, 3, new(recordingFault))
+	if report.Faulted() {
+		t.Errorf("Report claims a fault when the fault model did nothing")
+	}
+
+	signature := Ht_sign(params, message, SKseed, PKseed, 5, 3)
+	for !report.Faulted() { // the bit flip fault may flip no bits
+		var faultySignature *HTSignature
+		faultySignature, report = Ht_sign_fault_report(params, message, SKseed, PKseed, 5, 3, &BitFlipFault{MaxBits: 64, Layer: 4})
+		if !report.Faulted() {
+			continue
+		}
+		layerReport := report.Layer(4)
+		if layerReport == nil || len(report.Layers) != 1 {
+			t.Fatalf("Expected a single fault in layer 4")
+		}
+		correct := signature.GetXMSSSignature(4)
+		faulty := faultySignature.GetXMSSSignature(4)
+		for _, bit := range layerReport.AuthBits {
+			faulty.AUTH[bit>>3] ^= 1 << (bit % 8)
+		}
+		for _, bit := range layerReport.WotsBits {
+			faulty.WotsSignature[bit>>3] ^= 1 << (bit % 8)
+		}
+		if !reflect.DeepEqual(correct, faulty) {
+			t.Errorf("Undoing the reported bit flips didn't recover the correct signature")
+		}
+		if !layerReport.RootChanged {
+			t.Errorf("Expected the faulty signature to change the root")
+		}
+	}
+}
+
+// Tests that aborting a chain only changes one WOTS chain value of the target layer.
+func TestChainSkipFault(t *testing.T) {
+	params := parameters.MakeSphincsPlusSHA256128fRobust(false)
+	message := make([]byte, params.N)
+	rand.Read(message)
+	SKseed := make([]byte, params.N)
+	rand.Read(SKseed)
+	PKseed := make([]byte, params.N)
+	rand.Read(PKseed)
+
+	signature := Ht_sign(params, message, SKseed, PKseed, 5, 3)
+	faultModel := &ChainSkipFault{Skips: 1, Layer: params.D - 1, Abort: true}
+	for {
+		faultySignature, report := Ht_sign_fault_report(params, message, SKseed, PKseed, 5, 3, faultModel)
+		if !report.Faulted() { // the chosen chain may not be hashed at all
+			continue
+		}
+		layerReport := report.Layer(params.D - 1)
+		if layerReport == nil || len(report.Layers) != 1 {
+			t.Fatalf("Expected a single fault in the top layer")
+		}
+		if len(layerReport.AuthBits) != 0 {
+			t.Errorf("Chain fault changed AUTH")
+		}
+		chainIdx := layerReport.WotsBits[0] / (8 * params.N)
+		for _, bit := range layerReport.WotsBits {
+			if bit/(8*params.N) != chainIdx {
+				t.Errorf("Chain fault changed more than one chain")
+			}
+		}
+		for layer := 0; layer < params.D-1; layer++ {
+			if !reflect.DeepEqual(signature.GetXMSSSignature(layer), faultySignature.GetXMSSSignature(layer)) {
+				t.Errorf("Layer %d changed when only the top layer was faulted", layer)
+			}
+		}
+		break
+	}
+}
+
+// Tests that a root fault only changes the signature of the layer above, which signs the faulty root.
+func TestSubtreeRootFault(t *testing.T) {
+	params := parameters.MakeSphincsPlusSHA256128fRobust(false)
+	message := make([]byte, params.N)
+	rand.Read(message)
+	SKseed := make([]byte, params.N)
+	rand.Read(SKseed)
+	PKseed := make([]byte, params.N)
+	rand.Read(PKseed)
+	PK := Ht_PKgen(params, SKseed, PKseed)
+
+	signature := Ht_sign(params, message, SKseed, PKseed, 5, 3)
+	faultLayer := params.D - 3
+	for height := 0; height <= params.Hprime; height++ {
+		faultySignature, report := Ht_sign_fault_report(params, message, SKseed, PKseed, 5, 3, &SubtreeRootFault{Height: height, Layer: faultLayer})
+		for layer := 0; layer < params.D; layer++ {
+			same := reflect.DeepEqual(signature.GetXMSSSignature(layer), faultySignature.GetXMSSSignature(layer))
+			if same != (layer != faultLayer+1) {
+				t.Errorf("Root fault at height %d: layer %d changed %t", height, layer, !same)
+			}
+		}
+		layerReport := report.Layer(faultLayer)
+		if len(report.Layers) != 1 || layerReport == nil || !layerReport.RootChanged {
+			t.Errorf("Expected the report to only show a changed root in layer %d", faultLayer)
+		}
+		if Ht_verify(params, message, faultySignature, PKseed, 5, 3, PK) {
+			t.Errorf("Signature with a faulty root verified")
+		}
+	}
+}
+
+// Tests that corrupting each ADRS word while signing the top layer changes only its signature.
+func TestAddressFault(t *testing.T) {
+	params := parameters.MakeSphincsPlusSHA256128fRobust(false)
+	message := make([]byte, params.N)
+	rand.Read(message)
+	SKseed := make([]byte, params.N)
+	rand.Read(SKseed)
+	PKseed := make([]byte, params.N)
+	rand.Read(PKseed)
+
+	signature := Ht_sign(params, message, SKseed, PKseed, 5, 3)
+	for _, word := range []string{LayerWord, TreeWord, KeyPairWord, ChainWord, HashWord} {
+		faultModel := &AddressFault{Word: word, Layer: params.D - 1, Call: -1}
+		faultySignature, report := Ht_sign_fault_report(params, message, SKseed, PKseed, 5, 3, faultModel)
+		// bits dropped when compressing the address leave the signature unchanged
+		if len(report.Layers) > 1 || (report.Faulted() && report.Layer(params.D-1) == nil) {
+			t.Errorf("Expected corrupting the %s word to fault only the top layer", word)
+		}
+		if word == ChainWord && !report.Faulted() {
+			t.Errorf("Corrupting the chain word of every call didn't change the signature")
+		}
+		for layer := 0; layer < params.D-1; layer++ {
+			if !reflect.DeepEqual(signature.GetXMSSSignature(layer), faultySignature.GetXMSSSignature(layer)) {
+				t.Errorf("Corrupting the %s word changed layer %d", word, layer)
+			}
+		}
+	}
+
+	faultySignature, _ := Ht_sign_fault_report(params, message, SKseed, PKseed, 5, 3, &AddressFault{Word: ChainWord, Layer: params.D - 1, Call: 1 << 30})
+	if !reflect.DeepEqual(signature, faultySignature) {
+		t.Errorf("Corrupting a call which is never made changed the signature")
+	}
+}
+
+// Tests that a fixed fault magnitude always flips exactly that many bits.
+func TestBitFlipFaultMagnitude(t *testing.T) {
+	params := parameters.MakeSphincsPlusSHA256128fRobust(false)
+	message := make([]byte, params.N)
+	rand.Read(message)
+	SKseed := make([]byte, params.N)
+	rand.Read(SKseed)
+	PKseed := make([]byte, params.N)
+	rand.Read(PKseed)
+
+	for _, magnitude := range []Magnitude{FixedMagnitude(1), UniformMagnitude(1), GeometricMagnitude(1)} {
+		faultModel := &BitFlipFault{Layer: 2, Magnitude: magnitude}
+		_, report := Ht_sign_fault_report(params, message, SKseed, PKseed, 5, 3, faultModel)
+		layerReport := report.Layer(2)
+		if layerReport == nil || len(layerReport.AuthBits)+len(layerReport.WotsBits) != 1 {
+			t.Errorf("Expected exactly one bit to be flipped")
+		}
+	}
+}
+
+// Tests that a MultiFault injects each of its faults into the same signature.
+func TestMultiFault(t *testing.T) {
+	params := parameters.MakeSphincsPlusSHA256128fRobust(false)
+	message := make([]byte, params.N)
+	rand.Read(message)
+	SKseed := make([]byte, params.N)
+	rand.Read(SKseed)
+	PKseed := make([]byte, params.N)
+	rand.Read(PKseed)
+
+	signature := Ht_sign(params, message, SKseed, PKseed, 5, 3)
+	faultModel := &MultiFault{Faults: []FaultModel{
+		&BitFlipFault{Layer: 1, Magnitude: FixedMagnitude(8)},
+		&SubtreeRootFault{Height: params.Hprime, Layer: 3},
+	}}
+	faultySignature, report := Ht_sign_fault_report(params, message, SKseed, PKseed, 5, 3, faultModel)
+	if len(report.Layers) != 2 || report.Layer(1) == nil || report.Layer(3) == nil || !report.Layer(3).RootChanged {
+		t.Errorf("Expected the report to show faults in layers 1 and 3")
+	}
+	for layer := 0; layer < params.D; layer++ {
+		same := reflect.DeepEqual(signature.GetXMSSSignature(layer), faultySignature.GetXMSSSignature(layer))
+		if same != (layer != 1 && layer != 2 && layer != 4) {
+			t.Errorf("Layer %d changed %t", layer, !same)
+		}
+	}
+}
+
+func TestRandomLayerFault(t *testing.T) {
+	params := parameters.MakeSphincsPlusSHA256128fRobust(false)
+	message := make([]byte, params.N)
+	rand.Read(message)
+	SKseed := make([]byte, params.N)
+	rand.Read(SKseed)
+	PKseed := make([]byte, params.N)
+	rand.Read(PKseed)
+
+	faultModel := &RandomLayerFault{Faults: []FaultModel{
+		&BitFlipFault{Layer: 1, Magnitude: FixedMagnitude(8)},
+		&SubtreeRootFault{Height: params.Hprime, Layer: 4},
+	}}
+	seen := make(map[int]bool)
+	for i := 0; i < 20; i++ {
+		_, report := Ht_sign_fault_report(params, message, SKseed, PKseed, 5, 3, faultModel)
+		if len(report.Layers) != 1 || report.Layer(1) == nil && report.Layer(4) == nil {
+			t.Fatalf("Expected a single fault in layer 1 or 4")
+		}
+		seen[report.Layers[0].Layer] = true
+	}
+	if !seen[1] || !seen[4] {
+		t.Errorf("Expected both layers to be faulted in 20 signatures")
+	}
+
+	faultModel.Weights = []float64{0, 1}
+	for i := 0; i < 5; i++ {
+		_, report := Ht_sign_fault_report(params, message, SKseed, PKseed, 5, 3, faultModel)
+		if report.Layer(1) != nil {
+			t.Errorf("Layer 1 was faulted with weight 0")
+		}
+	}
+}
@@ -1,15 +1,341 @@
 package main
 
 import (
+	"encoding/hex"
+	"flag"
 	"fmt"
 	"os"
+	"strconv"
+	"strings"
+
+	"github.com/kasperdi/SPHINCSPLUS-golang/hypertree"
+	"github.com/kasperdi/SPHINCSPLUS-golang/parameters"
+	"github.com/kasperdi/SPHINCSPLUS-golang/util"
+)
+
+// attackOptions holds the command line options shared by every attack type
+type attackOptions struct {
+	params     *parameters.Parameters
+	paramSet   string
+	fault      string
+	faultLayer int
+	skips      int
+	height     int
+	// probability that a faulty signing query is actually faulted, and the spec of the bits flipped by bitflip faults
+	probability float64
+	magnitude   string
+	// distribution of the faulted layer, drawn for every faulty signature instead of always faulting faultLayer
+	layers       string
+	faultLayers  []int
+	layerWeights []float64
+	// derive the top layer WOTS keys from faulty signatures alone, without any valid signatures
+	derive bool
+	// sign a new message in every query, rather than always the attacked message
+	distinct bool
+	// attack state files to resume from and save to, and how many times the attack has been resumed
+	load    string
+	save    string
+	session int
+	seed    []byte
+	// address of a remote signing oracle to attack instead of simulating one, e.g. tcp:127.0.0.1:7000
+	oracle string
+	// transcript file to record every oracle query to, and transcript to replay instead of querying an oracle
+	transcript string
+	replay     string
+}
+
+// defaultParameterSet is attacked when no parameter set is given
+const defaultParameterSet = "sha256-256f-robust"
+
+// parameterSets maps the name of every parameter set to its constructor
+var parameterSets = map[string]func(RANDOMIZE bool) *parameters.Parameters{
+	"sha256-128f-robust":   parameters.MakeSphincsPlusSHA256128fRobust,
+	"sha256-128s-robust":   parameters.MakeSphincsPlusSHA256128sRobust,
+	"sha256-128f-simple":   parameters.MakeSphincsPlusSHA256128fSimple,
+	"sha256-128s-simple":   parameters.MakeSphincsPlusSHA256128sSimple,
+	"sha256-192f-robust":   parameters.MakeSphincsPlusSHA256192fRobust,
+	"sha256-192s-robust":   parameters.MakeSphincsPlusSHA256192sRobust,
+	"sha256-192f-simple":   parameters.MakeSphincsPlusSHA256192fSimple,
+	"sha256-192s-simple":   parameters.MakeSphincsPlusSHA256192sSimple,
+	"sha256-256f-robust":   parameters.MakeSphincsPlusSHA256256fRobust,
+	"sha256-256s-robust":   parameters.MakeSphincsPlusSHA256256sRobust,
+	"sha256-256f-simple":   parameters.MakeSphincsPlusSHA256256fSimple,
+	"sha256-256s-simple":   parameters.MakeSphincsPlusSHA256256sSimple,
+	"shake256-128f-robust": parameters.MakeSphincsPlusSHAKE256128fRobust,
+	"shake256-128s-robust": parameters.MakeSphincsPlusSHAKE256128sRobust,
+	"shake256-128f-simple": parameters.MakeSphincsPlusSHAKE256128fSimple,
+	"shake256-128s-simple": parameters.MakeSphincsPlusSHAKE256128sSimple,
+	"shake256-192f-robust": parameters.MakeSphincsPlusSHAKE256192fRobust,
+	"shake256-192s-robust": parameters.MakeSphincsPlusSHAKE256192sRobust,
+	"shake256-192f-simple": parameters.MakeSphincsPlusSHAKE256192fSimple,
+	"shake256-192s-simple": parameters.MakeSphincsPlusSHAKE256192sSimple,
+	"shake256-256f-robust": parameters.MakeSphincsPlusSHAKE256256fRobust,
+	"shake256-256s-robust": parameters.MakeSphincsPlusSHAKE256256sRobust,
+	"shake256-256f-simple": parameters.MakeSphincsPlusSHAKE256256fSimple,
+	"shake256-256s-simple": parameters.MakeSphincsPlusSHAKE256256sSimple,
+}
+
+// maxTargetKeyBits bounds the WOTS keys of a target layer to 2^maxTargetKeyBits, as the attacks need a valid
+// signature through every key they attack, or many faulty signatures per key
+const maxTargetKeyBits = 20
+
+// fault types selectable with -fault
+const (
+	bitFlipFault    = "bitflip" // flip bits of the XMSS signature, grafting onto the WOTS key above
+	chainSkipFault  = "skip"    // skip F iterations of a WOTS chain
+	chainAbortFault = "abort"   // stop a WOTS chain at a random iteration, leaking a value lower down the chain
+	rootFault       = "root"    // corrupt a node while computing a subtree root, as in Genêt et al.
 )
 
+// targetLayer returns the layer whose WOTS keys are attacked. Bit flips and root faults change the root signed by the
+// layer above, while chain faults leak values from the faulted layer's own WOTS key
+func (opts *attackOptions) targetLayer() int {
+	if opts.fault == bitFlipFault || opts.fault == rootFault {
+		return opts.faultLayer + 1
+	}
+	return opts.faultLayer
+}
+
+// faultedLayers returns every layer the oracle may fault
+func (opts *attackOptions) faultedLayers() []int {
+	if len(opts.faultLayers) > 0 {
+		return opts.faultLayers
+	}
+	return []int{opts.faultLayer}
+}
+
+// targetLayers returns the layer attacked for each of the faulted layers
+func (opts *attackOptions) targetLayers() []int {
+	targetLayers := make([]int, 0)
+	for _, layer := range opts.faultedLayers() {
+		if opts.fault == bitFlipFault || opts.fault == rootFault {
+			layer += 1
+		}
+		targetLayers = append(targetLayers, layer)
+	}
+	return targetLayers
+}
+
 func subCommandHelp() {
-	fmt.Println("expected 'singleSubtree' or 'singleSubtreeStats' or 'parallelSubtree' or 'parallelSubtreeStats'")
+	fmt.Println("expected 'singleSubtree' or 'singleSubtreeStats' or 'parallelSubtree' or 'parallelSubtreeStats' or 'addressFaults' or 'messageFaults' or 'forsLeak' or 'multiLayerFaults' or 'hashCallFaults' or 'forsGraft' or 'campaign' or 'forge' or 'oracle' or 'ingest'")
 	os.Exit(1)
 }
 
+// parseAttackFlags parses the options shared by every attack type
+func parseAttackFlags(name string, args []string) *attackOptions {
+	flags := flag.NewFlagSet(name, flag.ExitOnError)
+	paramSet := flags.String("params", defaultParameterSet, "parameter set, e.g. sha256-128s-simple or shake256-256f-robust")
+	fault := flags.String("fault", bitFlipFault, "fault type: bitflip, skip, abort or root")
+	faultLayer := flags.Int("layer", -1, "hypertree layer to fault (default D-2 for bitflip, D-1 for chain faults)")
+	skips := flags.Int("skips", 1, "number of F iterations skipped by skip faults")
+	height := flags.Int("height", -1, "height of the node corrupted by root faults, 0 is the WOTS leaf (default the subtree height)")
+	probability := flags.Float64("probability", 1, "probability that each faulty signing query is faulted")
+	magnitude := flags.String("magnitude", "", "bits flipped by bitflip faults: fixed:<n>, uniform:<max> or geometric:<p> (default up to 64)")
+	layers := flags.String("layers", "", "fault a random layer in every signature, e.g. 13,14 or 13:1,14:3 with relative weights (parallel attacks only)")
+	load := flags.String("load", "", "resume the attack saved in this file (singleSubtree and parallelSubtree only)")
+	save := flags.String("save", "", "save the attack to this file once collecting faults stops (singleSubtree and parallelSubtree only)")
+	derive := flags.Bool("derive", false, "derive the top layer WOTS keys from faulty signatures alone, without valid signatures (parallel attacks only)")
+	distinct := flags.Bool("distinct", false, "every valid and faulty query signs a new random message instead of the attacked one")
+	seedHex := flags.String("seed", "", "hex seed for all randomness used in the run (random if not given)")
+	oracle := flags.String("oracle", "", "attack the oracle served by 'oracle serve' at tcp:<host:port> or unix:<path> (singleSubtree and parallelSubtree only)")
+	transcript := flags.String("transcript", "", "append every oracle query and response to this transcript (singleSubtree and parallelSubtree only)")
+	replay := flags.String("replay", "", "replay the signatures of this transcript instead of querying an oracle (singleSubtree and parallelSubtree only)")
+	if err := flags.Parse(args); err != nil {
+		panic(err)
+	}
+
+	// sphincs+ parameters, with randomized signing so the parallel attacks see every WOTS key of the target layer
+	params := parseParameterSet(*paramSet, true)
+	if *height == -1 {
+		*height = params.Hprime
+	}
+
+	opts := &attackOptions{params: params, paramSet: strings.ToLower(*paramSet), fault: *fault, faultLayer: *faultLayer, skips: *skips, height: *height,
+		probability: *probability, magnitude: *magnitude, layers: *layers, derive: *derive, distinct: *distinct,
+		load: *load, save: *save, oracle: *oracle, transcript: *transcript, replay: *replay}
+	if err := opts.validate(); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	// the single attacks follow one WOTS key, so only the parallel attacks can route faults in other layers
+	if opts.layers != "" && strings.HasPrefix(name, "single") {
+		fmt.Println("layers can only be used with the parallel attacks")
+		os.Exit(1)
+	}
+	if opts.derive && strings.HasPrefix(name, "single") {
+		fmt.Println("derive can only be used with the parallel attacks")
+		os.Exit(1)
+	}
+	// the stats commands run many attacks, each from scratch
+	if (opts.load != "" || opts.save != "") && strings.HasSuffix(name, "Stats") {
+		fmt.Println("load and save can't be used with the stats commands")
+		os.Exit(1)
+	}
+	// each trial of the stats commands needs a new key pair
+	if (opts.oracle != "" || opts.transcript != "" || opts.replay != "") && strings.HasSuffix(name, "Stats") {
+		fmt.Println("oracle, transcript and replay can't be used with the stats commands")
+		os.Exit(1)
+	}
+	if opts.replay != "" && (opts.oracle != "" || opts.transcript != "") {
+		fmt.Println("replay can't be used with oracle or transcript")
+		os.Exit(1)
+	}
+	// a resumed attack keeps the seed it was started with
+	if opts.load != "" {
+		if *seedHex != "" {
+			fmt.Println("seed can't be given when resuming an attack")
+			os.Exit(1)
+		}
+		return opts
+	}
+	opts.seed = parseSeed(*seedHex)
+	return opts
+}
+
+// validate checks the options are consistent with the fault type, setting the default layer if faultLayer is -1
+func (opts *attackOptions) validate() error {
+	params := opts.params
+	if opts.probability <= 0 || opts.probability > 1 {
+		return fmt.Errorf("probability must be greater than 0 and at most 1")
+	}
+	if opts.magnitude != "" {
+		if opts.fault != bitFlipFault {
+			return fmt.Errorf("magnitude can only be used with bitflip faults")
+		}
+		if _, err := parseMagnitude(opts.magnitude); err != nil {
+			return err
+		}
+	}
+
+	// bit flips need a layer above to attack, chain faults attack the faulted layer itself
+	maxLayer := params.D - 1
+	switch opts.fault {
+	case bitFlipFault:
+		maxLayer = params.D - 2
+	case rootFault:
+		maxLayer = params.D - 2
+		if opts.height < 0 || opts.height > params.Hprime {
+			return fmt.Errorf("height must be between 0 and %d", params.Hprime)
+		}
+	case chainAbortFault:
+	case chainSkipFault:
+		if opts.skips < 1 {
+			return fmt.Errorf("skips must be at least 1")
+		}
+	default:
+		return fmt.Errorf("unknown fault type %s", opts.fault)
+	}
+	if opts.layers != "" {
+		if opts.faultLayer != -1 {
+			return fmt.Errorf("only one of layer and layers can be given")
+		}
+		var err error
+		if opts.faultLayers, opts.layerWeights, err = parseLayerDistribution(opts.layers, maxLayer); err != nil {
+			return err
+		}
+		// the highest layer is used wherever a single layer is needed, e.g. to print the key signed in debug mode
+		for _, layer := range opts.faultLayers {
+			if layer > opts.faultLayer {
+				opts.faultLayer = layer
+			}
+		}
+	}
+	if opts.faultLayer == -1 {
+		opts.faultLayer = maxLayer
+	}
+	if opts.faultLayer < 0 || opts.faultLayer > maxLayer {
+		return fmt.Errorf("layer must be between 0 and %d", maxLayer)
+	}
+	for _, targetLayer := range opts.targetLayers() {
+		if keyBits := (params.D - targetLayer) * params.Hprime; keyBits > maxTargetKeyBits {
+			return fmt.Errorf("target layer %d has 2^%d WOTS keys, at most 2^%d can be attacked", targetLayer, keyBits, maxTargetKeyBits)
+		}
+	}
+	// only bit flips leave a faulty root which can be recomputed from the signature, signed by a correct top layer
+	if opts.derive && (opts.fault != bitFlipFault || opts.layers != "" || opts.faultLayer != params.D-2) {
+		return fmt.Errorf("derive needs bitflip faults in layer %d", params.D-2)
+	}
+	return nil
+}
+
+// parseMagnitude parses a magnitude spec of the form fixed:<n>, uniform:<max> or geometric:<p>
+func parseMagnitude(spec string) (hypertree.Magnitude, error) {
+	parts := strings.SplitN(spec, ":", 2)
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("magnitude %s must be of the form <distribution>:<value>", spec)
+	}
+	switch parts[0] {
+	case "fixed", "uniform":
+		bits, err := strconv.Atoi(parts[1])
+		if err != nil || bits < 1 {
+			return nil, fmt.Errorf("%s magnitude needs a positive number of bits", parts[0])
+		}
+		if parts[0] == "fixed" {
+			return hypertree.FixedMagnitude(bits), nil
+		}
+		return hypertree.UniformMagnitude(bits), nil
+	case "geometric":
+		p, err := strconv.ParseFloat(parts[1], 64)
+		if err != nil || p <= 0 || p > 1 {
+			return nil, fmt.Errorf("geometric magnitude needs a probability greater than 0 and at most 1")
+		}
+		return hypertree.GeometricMagnitude(p), nil
+	}
+	return nil, fmt.Errorf("unknown magnitude distribution %s", parts[0])
+}
+
+// parseLayerDistribution parses a comma separated list of layers, each optionally followed by :<weight>. Layers
+// without a weight have weight 1
+func parseLayerDistribution(spec string, maxLayer int) ([]int, []float64, error) {
+	layers := make([]int, 0)
+	weights := make([]float64, 0)
+	for _, field := range strings.Split(spec, ",") {
+		parts := strings.SplitN(strings.TrimSpace(field), ":", 2)
+		layer, err := strconv.Atoi(parts[0])
+		if err != nil || layer < 0 || layer > maxLayer {
+			return nil, nil, fmt.Errorf("layers must be between 0 and %d", maxLayer)
+		}
+		for _, l := range layers {
+			if l == layer {
+				return nil, nil, fmt.Errorf("layer %d is given twice", layer)
+			}
+		}
+		weight := 1.0
+		if len(parts) == 2 {
+			if weight, err = strconv.ParseFloat(parts[1], 64); err != nil || weight <= 0 {
+				return nil, nil, fmt.Errorf("layer weights must be greater than 0")
+			}
+		}
+		layers = append(layers, layer)
+		weights = append(weights, weight)
+	}
+	return layers, weights, nil
+}
+
+// parseParameterSet creates the named parameter set, exiting if it doesn't exist
+func parseParameterSet(name string, RANDOMIZE bool) *parameters.Parameters {
+	makeParams, ok := parameterSets[strings.ToLower(name)]
+	if !ok {
+		fmt.Printf("unknown parameter set %s\n", name)
+		os.Exit(1)
+	}
+	return makeParams(RANDOMIZE)
+}
+
+// parseSeed decodes the -seed option, generating a random seed if it wasn't given
+func parseSeed(seedHex string) []byte {
+	seed := util.NewSeed()
+	if seedHex != "" {
+		var err error
+		if seed, err = hex.DecodeString(seedHex); err != nil {
+			fmt.Printf("seed must be hex encoded: %s\n", err)
+			os.Exit(1)
+		}
+	}
+	fmt.Printf("Seed: %x\n", seed)
+	return seed
+}
+
 func main() {
 	if len(os.Args) < 2 {
 		subCommandHelp()
@@ -18,13 +344,33 @@ func main() {
 	switch os.Args[1] {
 
 	case "singleSubtree":
-		singleSubtree()
+		singleSubtree(parseAttackFlags(os.Args[1], os.Args[2:]))
 	case "singleSubtreeStats":
-		singleSubtreeStats()
+		singleSubtreeStats(parseAttackFlags(os.Args[1], os.Args[2:]))
 	case "parallelSubtree":
-		parallelSubtree()
+		parallelSubtree(parseAttackFlags(os.Args[1], os.Args[2:]))
 	case "parallelSubtreeStats":
-		parallelSubtreeStats()
+		parallelSubtreeStats(parseAttackFlags(os.Args[1], os.Args[2:]))
+	case "addressFaults":
+		addressFaults(os.Args[2:])
+	case "messageFaults":
+		messageFaults(os.Args[2:])
+	case "forsLeak":
+		forsLeak(os.Args[2:])
+	case "multiLayerFaults":
+		multiLayerFaults(os.Args[2:])
+	case "hashCallFaults":
+		hashCallFaults(os.Args[2:])
+	case "forsGraft":
+		forsGraft(os.Args[2:])
+	case "campaign":
+		campaign(os.Args[2:])
+	case "forge":
+		forgeFromState(os.Args[2:])
+	case "oracle":
+		oracleCommand(os.Args[2:])
+	case "ingest":
+		ingest(os.Args[2:])
 	default:
 		subCommandHelp()
 	}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"fmt"
+	"github.com/kasperdi/SPHINCSPLUS-golang/attack"
+	"github.com/kasperdi/SPHINCSPLUS-golang/hypertree"
+	"github.com/kasperdi/SPHINCSPLUS-golang/parameters"
+	"github.com/kasperdi/SPHINCSPLUS-golang/sphincs"
+	"github.com/kasperdi/SPHINCSPLUS-golang/util"
+	"io"
+	mathrand "math/rand"
+	"net"
+	"os"
+	"strings"
+	"sync"
+)
+
+// simulatedOracle is a signing oracle holding its secret key in process. It keeps the ground truth of every fault
+// it injects in faults, for the experimenter only
+type simulatedOracle struct {
+	params *parameters.Parameters
+	sk     *sphincs.SPHINCS_SK
+	pk     *sphincs.SPHINCS_PK
+	// the fault only fires with faultProbability, drawn from occurrence, otherwise the message is signed correctly
+	faultModel       hypertree.FaultModel
+	faultProbability float64
+	occurrence       *mathrand.Rand
+	// layer whose secret hash chains are printed for valid signatures
+	targetLayer int
+	rng         io.Reader
+	faults      *faultLog
+
+	mutex       sync.Mutex
+	validSigns  int
+	faultySigns int
+	closed      bool
+}
+
+// createSigningOracle creates a simulated signing oracle with a new key pair drawn from rng
+func createSigningOracle(params *parameters.Parameters, faultModel hypertree.FaultModel, faultProbability float64,
+	occurrence *mathrand.Rand, targetLayer int, rng io.Reader) *simulatedOracle {
+	sk, pk := sphincs.Spx_keygen_rng(params, rng)
+	return newSimulatedOracle(params, sk, pk, faultModel, faultProbability, occurrence, targetLayer, rng)
+}
+
+// newSimulatedOracle creates a simulated signing oracle with an existing key pair, as createSigningOracle
+func newSimulatedOracle(params *parameters.Parameters, sk *sphincs.SPHINCS_SK, pk *sphincs.SPHINCS_PK, faultModel hypertree.FaultModel,
+	faultProbability float64, occurrence *mathrand.Rand, targetLayer int, rng io.Reader) *simulatedOracle {
+	return &simulatedOracle{params: params, sk: sk, pk: pk, faultModel: faultModel, faultProbability: faultProbability,
+		occurrence: occurrence, targetLayer: targetLayer, rng: rng, faults: new(faultLog)}
+}
+
+func (o *simulatedOracle) PublicKey() *sphincs.SPHINCS_PK {
+	return o.pk
+}
+
+func (o *simulatedOracle) Sign(message []byte) (*sphincs.SPHINCS_SIG, error) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	if o.closed {
+		return nil, attack.ErrOracleClosed
+	}
+	o.validSigns += 1
+	return sphincs.Spx_sign_debug(o.params, message, o.sk, o.targetLayer, o.rng), nil
+}
+
+func (o *simulatedOracle) SignFaulty(message []byte) (*sphincs.SPHINCS_SIG, error) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	if o.closed {
+		return nil, attack.ErrOracleClosed
+	}
+	o.faultySigns += 1
+	if o.faultProbability < 1 && o.occurrence.Float64() >= o.faultProbability {
+		o.faults.miss(&sphincs.FaultReport{FaultReport: new(hypertree.FaultReport)})
+		return sphincs.Spx_sign_rng(o.params, message, o.sk, o.rng), nil
+	}
+	signature, report := sphincs.Spx_sign_fault_report(o.params, message, o.sk, o.faultModel, o.rng)
+	o.faults.add(report)
+	return signature, nil
+}
+
+func (o *simulatedOracle) Queries() (int, int) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	return o.validSigns, o.faultySigns
+}
+
+func (o *simulatedOracle) Close() error {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	if o.closed {
+		return attack.ErrOracleClosed
+	}
+	o.closed = true
+	return nil
+}
+
+// querySign asks the oracle for a valid signature of message, exiting if it can't answer
+func querySign(oracle attack.SigningOracle, message []byte) *sphincs.SPHINCS_SIG {
+	signature, err := oracle.Sign(message)
+	if err != nil {
+		fmt.Printf("signing oracle failed: %s\n", err)
+		os.Exit(1)
+	}
+	return signature
+}
+
+// querySignFaulty asks the oracle for a faulty signature of message, exiting if it can't answer. It returns nil once
+// a replayed transcript has no more faulty signatures
+func querySignFaulty(oracle attack.SigningOracle, message []byte) *sphincs.SPHINCS_SIG {
+	signature, err := oracle.SignFaulty(message)
+	if err == attack.ErrTranscriptEnd {
+		fmt.Println("Transcript has no more faulty signatures")
+		return nil
+	}
+	if err != nil {
+		fmt.Printf("signing oracle failed: %s\n", err)
+		os.Exit(1)
+	}
+	return signature
+}
+
+// closeOracle stops the oracle, printing how many times it signed and faultily signed a message, and exits if it fails
+func closeOracle(oracle attack.SigningOracle) {
+	if err := oracle.Close(); err != nil {
+		fmt.Printf("could not stop signing oracle: %s\n", err)
+		os.Exit(1)
+	}
+	validSigns, faultySigns := oracle.Queries()
+	fmt.Println("Oracle stopping")
+	fmt.Printf("Signed correctly: %d\n", validSigns)
+	fmt.Printf("Signed with fault: %d\n", faultySigns)
+}
+
+// dialSigningOracle connects to the remote oracle at opts.oracle, exiting if it can't
+func dialSigningOracle(opts *attackOptions) *attack.RemoteOracle {
+	network, address := splitOracleAddress(opts.oracle)
+	oracle, err := attack.DialOracle(network, address, opts.params, opts.paramSet)
+	if err != nil {
+		fmt.Printf("could not connect to signing oracle %s: %s\n", opts.oracle, err)
+		os.Exit(1)
+	}
+	fmt.Printf("Connected to signing oracle %s\n", opts.oracle)
+	return oracle
+}
+
+// replaySigningOracle reads the transcript opts.replay to replay, exiting if it can't
+func replaySigningOracle(opts *attackOptions) *attack.ReplayOracle {
+	oracle, err := attack.NewReplayOracle(opts.params, opts.replay, opts.paramSet)
+	if err != nil {
+		fmt.Printf("could not read transcript %s: %s\n", opts.replay, err)
+		os.Exit(1)
+	}
+	fmt.Printf("Replaying transcript %s\n", opts.replay)
+	return oracle
+}
+
+// recordSigningOracle records the queries made to oracle to the transcript opts.transcript, exiting if it can't
+func recordSigningOracle(opts *attackOptions, oracle attack.SigningOracle) *attack.RecordingOracle {
+	recorder, err := attack.NewRecordingOracle(oracle, opts.transcript, opts.paramSet)
+	if err != nil {
+		fmt.Printf("could not open transcript %s: %s\n", opts.transcript, err)
+		os.Exit(1)
+	}
+	return recorder
+}
+
+// splitOracleAddress splits an oracle address of the form tcp:<host:port> or unix:<path> into its network and address
+func splitOracleAddress(oracleAddress string) (string, string) {
+	network, address, found := strings.Cut(oracleAddress, ":")
+	if !found || (network != "tcp" && network != "unix") || address == "" {
+		fmt.Printf("oracle address %s must be tcp:<host:port> or unix:<path>\n", oracleAddress)
+		os.Exit(1)
+	}
+	return network, address
+}
+
+// oracleCommand runs 'oracle serve', which serves a simulated faulty signer to attacks run with -oracle, as a real
+// device would be in its own process. It takes the fault options of the attacks, and stops when enter is pressed
+func oracleCommand(args []string) {
+	if len(args) < 2 || args[0] != "serve" {
+		fmt.Println("expected 'oracle serve <tcp:host:port|unix:path>' followed by the fault options of the attacks")
+		os.Exit(1)
+	}
+	network, address := splitOracleAddress(args[1])
+	opts := parseAttackFlags("oracle serve", args[2:])
+	if opts.save != "" || opts.oracle != "" || opts.replay != "" {
+		fmt.Println("save, oracle and replay can't be used when serving an oracle")
+		os.Exit(1)
+	}
+	// serve the key pair of a saved attack, with new randomness for its next session
+	loadAttack(opts)
+	simulated := createSimulatedOracle(opts, util.NewDRBG(opts.seed))
+	var oracle attack.SigningOracle = simulated
+	if opts.transcript != "" {
+		oracle = recordSigningOracle(opts, oracle)
+	}
+
+	listener, err := net.Listen(network, address)
+	if err != nil {
+		fmt.Printf("could not listen on %s: %s\n", args[1], err)
+		os.Exit(1)
+	}
+	served := make(chan error)
+	go func() {
+		served <- attack.ServeOracle(listener, oracle, opts.paramSet)
+	}()
+	fmt.Printf("Serving signing oracle %s with %s on %s. Press enter to stop\n", opts.paramSet, opts.fault, args[1])
+
+	<-waitForUserInput()
+	if err := listener.Close(); err != nil {
+		panic(err)
+	}
+	if err := <-served; err != nil {
+		fmt.Printf("signing oracle failed: %s\n", err)
+		os.Exit(1)
+	}
+	closeOracle(oracle)
+	simulated.faults.printSummary(opts.faultedLayers())
+}
@@ -107,6 +107,12 @@ func MakeSphincsPlusSHAKE256128sSimple(RANDOMIZE bool) *Parameters {
 	return MakeSphincsPlus(16, 16, 63, 7, 14, 12, "SHAKE256-simple", RANDOMIZE)
 }
 
+// MakeSphincsPlusToy is not a standard parameter set. Its 12 bit hypertree of 3 layers is small enough to search for
+// a randomizer using a chosen layer 0 leaf, and to run whole attacks in tests
+func MakeSphincsPlusToy(RANDOMIZE bool) *Parameters {
+	return MakeSphincsPlus(16, 16, 12, 3, 14, 6, "SHA256-robust", RANDOMIZE)
+}
+
 func MakeSphincsPlus(n int, w int, h int, d int, k int, logt int, hashFunc string, RANDOMIZE bool) *Parameters {
 	params := new(Parameters)
 	params.N = n
@@ -128,15 +134,15 @@ func MakeSphincsPlus(n int, w int, h int, d int, k int, logt int, hashFunc strin
 	m := md_len + idx_tree_len + idx_leaf_len
 	switch hashFunc {
 	case "SHA256-robust":
-		params.Tweak = &tweakable.Sha256Tweak{tweakable.Robust, m, n}
+		params.Tweak = &tweakable.Sha256Tweak{Variant: tweakable.Robust, MessageDigestLength: m, N: n}
 	case "SHA256-simple":
-		params.Tweak = &tweakable.Sha256Tweak{tweakable.Simple, m, n}
+		params.Tweak = &tweakable.Sha256Tweak{Variant: tweakable.Simple, MessageDigestLength: m, N: n}
 	case "SHAKE256-robust":
-		params.Tweak = &tweakable.Shake256Tweak{tweakable.Robust, m, n}
+		params.Tweak = &tweakable.Shake256Tweak{Variant: tweakable.Robust, MessageDigestLength: m, N: n}
 	case "SHAKE256-simple":
-		params.Tweak = &tweakable.Shake256Tweak{tweakable.Simple, m, n}
+		params.Tweak = &tweakable.Shake256Tweak{Variant: tweakable.Simple, MessageDigestLength: m, N: n}
 	default:
-		params.Tweak = &tweakable.Sha256Tweak{tweakable.Robust, m, n}
+		params.Tweak = &tweakable.Sha256Tweak{Variant: tweakable.Robust, MessageDigestLength: m, N: n}
 	}
 	return params
 }
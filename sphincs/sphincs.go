@@ -2,6 +2,7 @@ package sphincs
 
 import (
 	"crypto/rand"
+	"io"
 	"math"
 
 	"github.com/kasperdi/SPHINCSPLUS-golang/address"
@@ -42,14 +43,19 @@ func (s *SPHINCS_SIG) GetSIG_HT() *hypertree.HTSignature {
 }
 
 func Spx_keygen(params *parameters.Parameters) (*SPHINCS_SK, *SPHINCS_PK) {
+	return Spx_keygen_rng(params, rand.Reader)
+}
+
+// Spx_keygen_rng generates a key pair with the seeds read from rng
+func Spx_keygen_rng(params *parameters.Parameters, rng io.Reader) (*SPHINCS_SK, *SPHINCS_PK) {
 	SKseed := make([]byte, params.N)
-	rand.Read(SKseed)
+	rng.Read(SKseed)
 
 	SKprf := make([]byte, params.N)
-	rand.Read(SKprf)
+	rng.Read(SKprf)
 
 	PKseed := make([]byte, params.N)
-	rand.Read(PKseed)
+	rng.Read(PKseed)
 
 	PKroot := hypertree.Ht_PKgen(params, SKseed, PKseed)
 
@@ -67,13 +73,18 @@ func Spx_keygen(params *parameters.Parameters) (*SPHINCS_SK, *SPHINCS_PK) {
 }
 
 func Spx_sign(params *parameters.Parameters, M []byte, SK *SPHINCS_SK) *SPHINCS_SIG {
+	return Spx_sign_rng(params, M, SK, rand.Reader)
+}
+
+// Spx_sign_rng signs M, reading the randomizer from rng when params.RANDOMIZE is set
+func Spx_sign_rng(params *parameters.Parameters, M []byte, SK *SPHINCS_SK, rng io.Reader) *SPHINCS_SIG {
 	// init
 	adrs := new(address.ADRS)
 
 	// generate randomizer
 	opt := make([]byte, params.N)
 	if params.RANDOMIZE {
-		rand.Read(opt)
+		rng.Read(opt)
 	}
 
 	R := params.Tweak.PRFmsg(SK.SKprf, opt, M)
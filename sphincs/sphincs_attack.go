@@ -9,7 +9,9 @@ import (
 	"math"
 )
 
-func Spx_verify_get_msg_sig_tree(params *parameters.Parameters, M []byte, SIG *SPHINCS_SIG, PK *SPHINCS_PK) (bool, []byte, []byte, uint64) {
+// Spx_verify_get_msg_sig_tree verifies SIG and returns the message and WOTS signature used in the given hypertree layer,
+// along with the tree index selected by the message digest
+func Spx_verify_get_msg_sig_tree(params *parameters.Parameters, M []byte, SIG *SPHINCS_SIG, PK *SPHINCS_PK, layer int) (bool, []byte, []byte, uint64) {
 	// init
 	adrs := new(address.ADRS)
 	R := SIG.GetR()
@@ -46,6 +48,35 @@ func Spx_verify_get_msg_sig_tree(params *parameters.Parameters, M []byte, SIG *S
 
 	// verify HT signature
 	adrs.SetType(address.TREE)
-	success, msg, sig := hypertree.Ht_verify_get_msg_sig(params, PK_FORS, SIG_HT, PKseed, idx_tree, idx_leaf, PKroot)
+	success, msg, sig := hypertree.Ht_verify_get_msg_sig(params, PK_FORS, SIG_HT, PKseed, idx_tree, idx_leaf, PKroot, layer)
 	return success, msg, sig, idx_tree
 }
+
+// Spx_verify_get_msgs verifies SIG and returns the message signed in every hypertree layer, starting with the FORS
+// public key signed by layer 0
+func Spx_verify_get_msgs(params *parameters.Parameters, M []byte, SIG *SPHINCS_SIG, PK *SPHINCS_PK) (bool, [][]byte) {
+	// init
+	adrs := new(address.ADRS)
+
+	// compute message digest and index
+	digest := params.Tweak.Hmsg(SIG.GetR(), PK.PKseed, PK.PKroot, M)
+	tmp_md, idx_tree, idx_leaf := splitDigest(params, digest)
+
+	// compute FORS public key
+	adrs.SetLayerAddress(0)
+	adrs.SetTreeAddress(idx_tree)
+	adrs.SetType(address.FORS_TREE)
+	adrs.SetKeyPairAddress(idx_leaf)
+
+	// This ensures that we avoid side effects modifying PK
+	PKseed := make([]byte, params.N)
+	copy(PKseed, PK.PKseed)
+	PKroot := make([]byte, params.N)
+	copy(PKroot, PK.PKroot)
+
+	PK_FORS := fors.Fors_pkFromSig(params, SIG.GetSIG_FORS(), tmp_md, PKseed, adrs)
+
+	// verify HT signature
+	adrs.SetType(address.TREE)
+	return hypertree.Ht_verify_get_msgs(params, PK_FORS, SIG.GetSIG_HT(), PKseed, idx_tree, idx_leaf, PKroot)
+}
@@ -1,23 +1,24 @@
 package sphincs
 
 import (
-	"crypto/rand"
 	"github.com/kasperdi/SPHINCSPLUS-golang/address"
 	"github.com/kasperdi/SPHINCSPLUS-golang/fors"
 	"github.com/kasperdi/SPHINCSPLUS-golang/hypertree"
 	"github.com/kasperdi/SPHINCSPLUS-golang/parameters"
 	"github.com/kasperdi/SPHINCSPLUS-golang/util"
+	"io"
 	"math"
 )
 
-func Spx_sign_debug(params *parameters.Parameters, M []byte, SK *SPHINCS_SK) *SPHINCS_SIG {
+// Spx_sign_debug signs M as in Spx_sign_rng, printing the WOTS secret key used in debugLayer of the hypertree
+func Spx_sign_debug(params *parameters.Parameters, M []byte, SK *SPHINCS_SK, debugLayer int, rng io.Reader) *SPHINCS_SIG {
 	// init
 	adrs := new(address.ADRS)
 
 	// generate randomizer
 	opt := make([]byte, params.N)
 	if params.RANDOMIZE {
-		rand.Read(opt)
+		rng.Read(opt)
 	}
 
 	R := params.Tweak.PRFmsg(SK.SKprf, opt, M)
@@ -56,7 +57,7 @@ func Spx_sign_debug(params *parameters.Parameters, M []byte, SK *SPHINCS_SK) *SP
 
 	// sign FORS public key with HT
 	adrs.SetType(address.TREE)
-	SIG.SIG_HT = hypertree.Ht_sign_debug(params, PK_FORS, SKseed, PKseed, idx_tree, idx_leaf)
+	SIG.SIG_HT = hypertree.Ht_sign_debug(params, PK_FORS, SKseed, PKseed, idx_tree, idx_leaf, debugLayer)
 
 	return SIG
 }
@@ -1,42 +1,261 @@
 package sphincs
 
 import (
-	"crypto/rand"
+	"bytes"
 	"github.com/kasperdi/SPHINCSPLUS-golang/address"
 	"github.com/kasperdi/SPHINCSPLUS-golang/fors"
 	"github.com/kasperdi/SPHINCSPLUS-golang/hypertree"
 	"github.com/kasperdi/SPHINCSPLUS-golang/parameters"
 	"github.com/kasperdi/SPHINCSPLUS-golang/util"
+	"github.com/kasperdi/SPHINCSPLUS-golang/xmss"
+	"io"
 	"math"
+	mathrand "math/rand"
 )
 
-func Spx_sign_fault(params *parameters.Parameters, M []byte, SK *SPHINCS_SK) *SPHINCS_SIG {
+// MessageFaultModel is implemented by fault models which also corrupt the randomizer R, the message digest or the
+// indices extracted from it. The faulty values are used for the rest of signing, and a faulty R is also put in the
+// signature.
+type MessageFaultModel interface {
+	hypertree.FaultModel
+	FaultR(params *parameters.Parameters, R []byte)
+	FaultDigest(params *parameters.Parameters, digest []byte)
+	FaultIdx(params *parameters.Parameters, idxTree uint64, idxLeaf int) (uint64, int)
+}
+
+// values which can be corrupted by MessageFault
+const (
+	RTarget       = "R"
+	DigestTarget  = "digest"
+	IdxTreeTarget = "idx_tree"
+	IdxLeafTarget = "idx_leaf"
+)
+
+// MessageFault flips Bits random bits of Target while Spx_sign computes the randomizer and message digest. Bits of
+// the digest, idx_tree and idx_leaf are only flipped where they are used by signing.
+type MessageFault struct {
+	Target string
+	Bits   int
+	Rand   *mathrand.Rand
+}
+
+// Fault does nothing as the hypertree itself is signed correctly
+func (f *MessageFault) Fault(params *parameters.Parameters, layer int, idxTree uint64, idxLeaf int, SIG_XMSS *xmss.XMSSSignature, root []byte) {
+}
+
+func (f *MessageFault) FaultR(params *parameters.Parameters, R []byte) {
+	if f.Target == RTarget {
+		f.flipBits(R, 8*len(R))
+	}
+}
+
+// FaultDigest only flips the bits of the digest which are used, as those padding the FORS message and indices to whole
+// bytes change nothing
+func (f *MessageFault) FaultDigest(params *parameters.Parameters, digest []byte) {
+	if f.Target == DigestTarget {
+		bits := usedDigestBits(params)
+		for i := 0; i < f.Bits; i++ {
+			targetBit := bits[util.Intn(f.Rand, len(bits))]
+			digest[targetBit>>3] ^= 1 << (targetBit % 8)
+		}
+	}
+}
+
+func (f *MessageFault) FaultIdx(params *parameters.Parameters, idxTree uint64, idxLeaf int) (uint64, int) {
+	switch f.Target {
+	case IdxTreeTarget:
+		for i := 0; i < f.Bits; i++ {
+			idxTree ^= 1 << util.Intn(f.Rand, params.H-params.H/params.D)
+		}
+	case IdxLeafTarget:
+		for i := 0; i < f.Bits; i++ {
+			idxLeaf ^= 1 << util.Intn(f.Rand, params.H/params.D)
+		}
+	}
+	return idxTree, idxLeaf
+}
+
+func (f *MessageFault) flipBits(value []byte, bits int) {
+	for i := 0; i < f.Bits; i++ {
+		targetBit := util.Intn(f.Rand, bits)
+		value[targetBit>>3] ^= 1 << (targetBit % 8)
+	}
+}
+
+// ForsFaultModel is implemented by fault models which corrupt the FORS signature. ForsIndexFault is called before
+// signing and returns nil to use the correct indices, and FaultFors may then mutate the TreePKAUTH output in place.
+// The FORS public key signed by the hypertree is computed from the faulty signature.
+type ForsFaultModel interface {
+	hypertree.FaultModel
+	ForsIndexFault(params *parameters.Parameters) fors.IndexFault
+	FaultFors(params *parameters.Parameters, SIG_FORS *fors.FORSSignature)
+}
+
+// ForsPKFaultModel is implemented by fault models which corrupt the FORS public key after it has been computed from
+// the FORS signature, so layer 0 of the hypertree signs a value the FORS signature doesn't lead to
+type ForsPKFaultModel interface {
+	hypertree.FaultModel
+	FaultPKFors(params *parameters.Parameters, PK_FORS []byte)
+}
+
+// parts of the FORS signature which can be corrupted by ForsFault
+const (
+	IndicesTarget    = "indices"
+	TreePKAUTHTarget = "treepkauth"
+	PKForsTarget     = "pkfors"
+)
+
+// ForsFault corrupts one random FORS tree. The indices target flips Bits bits of the index computed by
+// message_to_indices, revealing a different secret leaf together with its AUTH path. The treepkauth target flips Bits
+// bits of the tree's secret leaf and AUTH path after they have been computed. The pkfors target instead flips Bits
+// bits of the FORS public key signed by layer 0.
+type ForsFault struct {
+	Target string
+	Bits   int
+	Rand   *mathrand.Rand
+}
+
+// Fault does nothing as the hypertree itself is signed correctly
+func (f *ForsFault) Fault(params *parameters.Parameters, layer int, idxTree uint64, idxLeaf int, SIG_XMSS *xmss.XMSSSignature, root []byte) {
+}
+
+func (f *ForsFault) ForsIndexFault(params *parameters.Parameters) fors.IndexFault {
+	if f.Target != IndicesTarget {
+		return nil
+	}
+	targetTree := util.Intn(f.Rand, params.K)
+	return func(tree int, index int) int {
+		if tree != targetTree {
+			return index
+		}
+		for i := 0; i < f.Bits; i++ {
+			index ^= 1 << util.Intn(f.Rand, params.A)
+		}
+		return index
+	}
+}
+
+func (f *ForsFault) FaultFors(params *parameters.Parameters, SIG_FORS *fors.FORSSignature) {
+	if f.Target != TreePKAUTHTarget {
+		return
+	}
+	treePKAUTH := SIG_FORS.Forspkauth[util.Intn(f.Rand, params.K)]
+	for i := 0; i < f.Bits; i++ {
+		targetBit := util.Intn(f.Rand, 8*(len(treePKAUTH.PrivateKeyValue)+len(treePKAUTH.AUTH)))
+		if targetBit >= 8*len(treePKAUTH.PrivateKeyValue) {
+			targetBit -= 8 * len(treePKAUTH.PrivateKeyValue)
+			treePKAUTH.AUTH[targetBit>>3] ^= 1 << (targetBit % 8)
+		} else {
+			treePKAUTH.PrivateKeyValue[targetBit>>3] ^= 1 << (targetBit % 8)
+		}
+	}
+}
+
+func (f *ForsFault) FaultPKFors(params *parameters.Parameters, PK_FORS []byte) {
+	if f.Target != PKForsTarget {
+		return
+	}
+	for i := 0; i < f.Bits; i++ {
+		targetBit := util.Intn(f.Rand, 8*len(PK_FORS))
+		PK_FORS[targetBit>>3] ^= 1 << (targetBit % 8)
+	}
+}
+
+// MultiFault injects the hypertree faults of the embedded hypertree.MultiFault and the FORS fault Fors, which may be
+// nil, into the same signature
+type MultiFault struct {
+	*hypertree.MultiFault
+	Fors ForsFaultModel
+}
+
+func (f *MultiFault) ForsIndexFault(params *parameters.Parameters) fors.IndexFault {
+	if f.Fors == nil {
+		return nil
+	}
+	return f.Fors.ForsIndexFault(params)
+}
+
+func (f *MultiFault) FaultFors(params *parameters.Parameters, SIG_FORS *fors.FORSSignature) {
+	if f.Fors != nil {
+		f.Fors.FaultFors(params, SIG_FORS)
+	}
+}
+
+func (f *MultiFault) FaultPKFors(params *parameters.Parameters, PK_FORS []byte) {
+	if forsPKFaultModel, ok := f.Fors.(ForsPKFaultModel); ok {
+		forsPKFaultModel.FaultPKFors(params, PK_FORS)
+	}
+}
+
+// FaultReport is the ground truth of the faults injected into a SPHINCS+ signature. It extends the hypertree report
+// with the faults on the randomizer and message digest.
+type FaultReport struct {
+	*hypertree.FaultReport
+	RBits      []int // positions of the bits flipped in R
+	DigestBits []int // positions of the bits flipped in the message digest
+	// indices the hypertree was signed with, after any faults
+	IdxTree uint64
+	IdxLeaf int
+	// whether the faults changed the FORS message or the indices compared to signing correctly
+	MdChanged  bool
+	IdxChanged bool
+	// FORS trees whose secret leaf or AUTH path differ from signing correctly
+	ForsTrees []int
+	// positions of the bits flipped in the FORS public key after computing it
+	PKForsBits []int
+}
+
+// Faulted returns true if anything in the signature was changed
+func (r *FaultReport) Faulted() bool {
+	return r.FaultReport.Faulted() || len(r.RBits) > 0 || len(r.DigestBits) > 0 || r.MdChanged || r.IdxChanged || len(r.ForsTrees) > 0 || len(r.PKForsBits) > 0
+}
+
+// Spx_sign_fault signs M as in Spx_sign_rng, but builds the hypertree with faultModel injecting faults
+func Spx_sign_fault(params *parameters.Parameters, M []byte, SK *SPHINCS_SK, faultModel hypertree.FaultModel, rng io.Reader) *SPHINCS_SIG {
+	SIG, _ := Spx_sign_fault_report(params, M, SK, faultModel, rng)
+	return SIG
+}
+
+// Spx_sign_fault_report signs M as in Spx_sign_fault, also returning the ground truth of the injected faults
+func Spx_sign_fault_report(params *parameters.Parameters, M []byte, SK *SPHINCS_SK, faultModel hypertree.FaultModel, rng io.Reader) (*SPHINCS_SIG, *FaultReport) {
 	// init
 	adrs := new(address.ADRS)
+	report := new(FaultReport)
+	messageFaultModel, faultMessage := faultModel.(MessageFaultModel)
 
 	// generate randomizer
 	opt := make([]byte, params.N)
 	if params.RANDOMIZE {
-		rand.Read(opt)
+		rng.Read(opt)
 	}
 
 	R := params.Tweak.PRFmsg(SK.SKprf, opt, M)
+	correctR := append([]byte(nil), R...)
+	if faultMessage {
+		messageFaultModel.FaultR(params, R)
+	}
+	report.RBits = util.FlippedBits(correctR, R)
 
 	SIG := new(SPHINCS_SIG)
 	SIG.R = R
 
 	// compute message digest and index
 	digest := params.Tweak.Hmsg(R, SK.PKseed, SK.PKroot, M)
-	tmp_md_bytes := int(math.Floor(float64(params.K*params.A+7) / 8))
-	tmp_idx_tree_bytes := int(math.Floor(float64(params.H-params.H/params.D+7) / 8))
-	tmp_idx_leaf_bytes := int(math.Floor(float64(params.H/params.D+7)) / 8)
-
-	tmp_md := digest[:tmp_md_bytes]
-	tmp_idx_tree := digest[tmp_md_bytes:(tmp_md_bytes + tmp_idx_tree_bytes)]
-	tmp_idx_leaf := digest[(tmp_md_bytes + tmp_idx_tree_bytes):(tmp_md_bytes + tmp_idx_tree_bytes + tmp_idx_leaf_bytes)]
-
-	idx_tree := uint64(util.BytesToUint64(tmp_idx_tree) & (math.MaxUint64 >> (64 - (params.H - params.H/params.D))))
-	idx_leaf := int(util.BytesToUint32(tmp_idx_leaf) & (math.MaxUint32 >> (32 - params.H/params.D)))
+	correctDigest := params.Tweak.Hmsg(correctR, SK.PKseed, SK.PKroot, M)
+	if faultMessage {
+		faultyDigest := append([]byte(nil), digest...)
+		messageFaultModel.FaultDigest(params, faultyDigest)
+		report.DigestBits = util.FlippedBits(digest, faultyDigest)
+		digest = faultyDigest
+	}
+	tmp_md, idx_tree, idx_leaf := splitDigest(params, digest)
+	correct_md, correct_idx_tree, correct_idx_leaf := splitDigest(params, correctDigest)
+	if faultMessage {
+		idx_tree, idx_leaf = messageFaultModel.FaultIdx(params, idx_tree, idx_leaf)
+	}
+	report.IdxTree, report.IdxLeaf = idx_tree, idx_leaf
+	report.MdChanged = !bytes.Equal(tmp_md, correct_md)
+	report.IdxChanged = idx_tree != correct_idx_tree || idx_leaf != correct_idx_leaf
 
 	// FORS sign
 	adrs.SetLayerAddress(0)
@@ -50,13 +269,91 @@ func Spx_sign_fault(params *parameters.Parameters, M []byte, SK *SPHINCS_SK) *SP
 	PKseed := make([]byte, params.N)
 	copy(PKseed, SK.PKseed)
 
-	SIG.SIG_FORS = fors.Fors_sign(params, tmp_md, SKseed, PKseed, adrs)
+	SIG.SIG_FORS, report.ForsTrees = signFors(params, faultModel, tmp_md, SKseed, PKseed, adrs)
 
 	PK_FORS := fors.Fors_pkFromSig(params, SIG.SIG_FORS, tmp_md, PKseed, adrs)
+	if forsPKFaultModel, ok := faultModel.(ForsPKFaultModel); ok {
+		correctPK_FORS := append([]byte(nil), PK_FORS...)
+		forsPKFaultModel.FaultPKFors(params, PK_FORS)
+		report.PKForsBits = util.FlippedBits(correctPK_FORS, PK_FORS)
+	}
 
 	// sign FORS public key with HT
 	adrs.SetType(address.TREE)
-	SIG.SIG_HT = hypertree.Ht_sign_fault(params, PK_FORS, SKseed, PKseed, idx_tree, idx_leaf)
+	SIG_HT, htReport := hypertree.Ht_sign_fault_report(params, PK_FORS, SKseed, PKseed, idx_tree, idx_leaf, faultModel)
+	SIG.SIG_HT = SIG_HT
+	report.FaultReport = htReport
 
-	return SIG
+	return SIG, report
+}
+
+// signFors computes the FORS signature, letting a ForsFaultModel corrupt it. It also returns the trees which differ
+// from the correct signature.
+func signFors(params *parameters.Parameters, faultModel hypertree.FaultModel, md []byte, SKseed []byte, PKseed []byte, adrs *address.ADRS) (*fors.FORSSignature, []int) {
+	forsFaultModel, ok := faultModel.(ForsFaultModel)
+	if !ok {
+		return fors.Fors_sign(params, md, SKseed, PKseed, adrs), []int{}
+	}
+
+	correct := fors.Fors_sign(params, md, SKseed, PKseed, adrs.Copy())
+	var SIG_FORS *fors.FORSSignature
+	if indexFault := forsFaultModel.ForsIndexFault(params); indexFault != nil {
+		SIG_FORS = fors.Fors_sign_fault(params, md, SKseed, PKseed, adrs.Copy(), indexFault)
+	} else {
+		// copy the signature so that the correct one is left untouched
+		SIG_FORS = new(fors.FORSSignature)
+		for _, treePKAUTH := range correct.Forspkauth {
+			SIG_FORS.Forspkauth = append(SIG_FORS.Forspkauth, &fors.TreePKAUTH{
+				PrivateKeyValue: append([]byte(nil), treePKAUTH.PrivateKeyValue...),
+				AUTH:            append([]byte(nil), treePKAUTH.AUTH...),
+			})
+		}
+	}
+	forsFaultModel.FaultFors(params, SIG_FORS)
+
+	faultyTrees := make([]int, 0)
+	for i := 0; i < params.K; i++ {
+		if !bytes.Equal(correct.GetSK(i), SIG_FORS.GetSK(i)) || !bytes.Equal(correct.GetAUTH(i), SIG_FORS.GetAUTH(i)) {
+			faultyTrees = append(faultyTrees, i)
+		}
+	}
+	return SIG_FORS, faultyTrees
+}
+
+// usedDigestBits returns the positions of the bits of the message digest which splitDigest uses, counting the bits of
+// each byte from the least significant as flipBits does: the first K*A bits of the FORS message, and the low bits of
+// the big endian idx_tree and idx_leaf
+func usedDigestBits(params *parameters.Parameters) []int {
+	tmp_md_bytes := (params.K*params.A + 7) / 8
+	tmp_idx_tree_bytes := (params.H - params.H/params.D + 7) / 8
+	tmp_idx_leaf_bytes := (params.H/params.D + 7) / 8
+
+	bits := make([]int, 0)
+	for bit := 0; bit < params.K*params.A; bit++ {
+		bits = append(bits, bit)
+	}
+	indexBits := func(start int, length int, used int) {
+		for significance := 0; significance < used; significance++ {
+			bits = append(bits, 8*(start+length-1-significance/8)+significance%8)
+		}
+	}
+	indexBits(tmp_md_bytes, tmp_idx_tree_bytes, params.H-params.H/params.D)
+	indexBits(tmp_md_bytes+tmp_idx_tree_bytes, tmp_idx_leaf_bytes, params.H/params.D)
+	return bits
+}
+
+// splitDigest extracts the FORS message and the hypertree indices from a message digest
+func splitDigest(params *parameters.Parameters, digest []byte) ([]byte, uint64, int) {
+	tmp_md_bytes := int(math.Floor(float64(params.K*params.A+7) / 8))
+	tmp_idx_tree_bytes := int(math.Floor(float64(params.H-params.H/params.D+7) / 8))
+	tmp_idx_leaf_bytes := int(math.Floor(float64(params.H/params.D+7)) / 8)
+
+	tmp_md := digest[:tmp_md_bytes]
+	tmp_idx_tree := digest[tmp_md_bytes:(tmp_md_bytes + tmp_idx_tree_bytes)]
+	tmp_idx_leaf := digest[(tmp_md_bytes + tmp_idx_tree_bytes):(tmp_md_bytes + tmp_idx_tree_bytes + tmp_idx_leaf_bytes)]
+
+	idx_tree := uint64(util.BytesToUint64(tmp_idx_tree) & (math.MaxUint64 >> (64 - (params.H - params.H/params.D))))
+	idx_leaf := int(util.BytesToUint32(tmp_idx_leaf) & (math.MaxUint32 >> (32 - params.H/params.D)))
+
+	return tmp_md, idx_tree, idx_leaf
 }
@@ -1,10 +1,12 @@
 package sphincs
 
 import (
+	"bytes"
 	"crypto/rand"
 	"encoding/hex"
 	"fmt"
 	"io/ioutil"
+	"reflect"
 	"testing"
 
 	"github.com/kasperdi/SPHINCSPLUS-golang/hypertree"
@@ -124,6 +126,129 @@ func TestSignAndVerifyNondeterministic(t *testing.T) {
 
 }
 
+// Tests the report and verification of signatures with a faulty R, digest or indices.
+func TestMessageFault(t *testing.T) {
+	params := parameters.MakeSphincsPlusSHA256128fRobust(false)
+
+	message := make([]byte, params.N)
+	rand.Read(message)
+
+	sk, pk := Spx_keygen(params)
+	cases := []struct {
+		Target     string
+		Verifies   bool
+		IdxChanged bool
+	}{
+		{Target: RTarget, Verifies: true},
+		{Target: IdxTreeTarget, IdxChanged: true},
+		{Target: IdxLeafTarget, IdxChanged: true},
+	}
+	for _, c := range cases {
+		signature, report := Spx_sign_fault_report(params, message, sk, &MessageFault{Target: c.Target, Bits: 1}, nil)
+		if !report.Faulted() {
+			t.Errorf("Faulting %s wasn't reported", c.Target)
+		}
+		if Spx_verify(params, message, signature, pk) != c.Verifies {
+			t.Errorf("Expected verification with a faulty %s to be %t", c.Target, c.Verifies)
+		}
+		if c.IdxChanged && !report.IdxChanged {
+			t.Errorf("Faulting %s didn't change the indices", c.Target)
+		}
+	}
+
+	// only flipping bits of the FORS message leaves the indices unchanged
+	signature, report := Spx_sign_fault_report(params, message, sk, &MessageFault{Target: DigestTarget, Bits: 1}, nil)
+	for len(report.DigestBits) != 1 || report.DigestBits[0] >= 8*(params.K*params.A/8) {
+		signature, report = Spx_sign_fault_report(params, message, sk, &MessageFault{Target: DigestTarget, Bits: 1}, nil)
+	}
+	if !report.MdChanged || report.IdxChanged {
+		t.Errorf("Expected a fault in the FORS message to only change the FORS message")
+	}
+	if Spx_verify(params, message, signature, pk) {
+		t.Errorf("Verification succeeded with a faulty FORS message")
+	}
+
+	// bits padding the FORS message and indices to whole bytes are never flipped, so every flip changes something
+	for i := 0; i < 50; i++ {
+		_, report := Spx_sign_fault_report(params, message, sk, &MessageFault{Target: DigestTarget, Bits: 1}, nil)
+		if !report.MdChanged && !report.IdxChanged {
+			t.Fatalf("Flipping digest bit %v changed neither the FORS message nor the indices", report.DigestBits)
+		}
+	}
+}
+
+// Tests that FORS faults are reported. As the FORS public key is computed from the faulty FORS signature, the
+// signature still verifies, but layer 0 signs a different FORS public key.
+func TestForsFault(t *testing.T) {
+	params := parameters.MakeSphincsPlusSHA256128fRobust(false)
+
+	message := make([]byte, params.N)
+	rand.Read(message)
+
+	sk, pk := Spx_keygen(params)
+	validSignature := Spx_sign(params, message, sk)
+	for _, target := range []string{IndicesTarget, TreePKAUTHTarget} {
+		signature, report := Spx_sign_fault_report(params, message, sk, &ForsFault{Target: target, Bits: 1}, nil)
+		if len(report.ForsTrees) != 1 || report.MdChanged || report.IdxChanged {
+			t.Errorf("Expected faulting the FORS %s to only change a single FORS tree", target)
+		}
+		if !Spx_verify(params, message, signature, pk) {
+			t.Errorf("Verification failed with faulty FORS %s", target)
+		}
+		if bytes.Equal(signature.SIG_HT.GetXMSSSignature(0).WotsSignature, validSignature.SIG_HT.GetXMSSSignature(0).WotsSignature) {
+			t.Errorf("Faulty FORS %s didn't change the FORS public key signed by layer 0", target)
+		}
+	}
+}
+
+// Tests that faulting the FORS public key makes layer 0 sign a different value, leaving the FORS signature unchanged.
+func TestForsPKFault(t *testing.T) {
+	params := parameters.MakeSphincsPlusSHA256128fRobust(false)
+
+	message := make([]byte, params.N)
+	rand.Read(message)
+
+	sk, pk := Spx_keygen(params)
+	validSignature := Spx_sign(params, message, sk)
+	signature, report := Spx_sign_fault_report(params, message, sk, &ForsFault{Target: PKForsTarget, Bits: 1}, nil)
+	if len(report.PKForsBits) != 1 || len(report.ForsTrees) != 0 || report.Layer(0) != nil {
+		t.Errorf("Expected only a single bit of the FORS public key to be flipped")
+	}
+	if !reflect.DeepEqual(signature.SIG_FORS, validSignature.SIG_FORS) {
+		t.Errorf("Faulting the FORS public key changed the FORS signature")
+	}
+	if bytes.Equal(signature.SIG_HT.GetXMSSSignature(0).WotsSignature, validSignature.SIG_HT.GetXMSSSignature(0).WotsSignature) {
+		t.Errorf("Faulty FORS public key wasn't signed by layer 0")
+	}
+	if Spx_verify(params, message, signature, pk) {
+		t.Errorf("Signature of a faulty FORS public key verified")
+	}
+}
+
+// Tests that a MultiFault faults FORS and several hypertree layers of the same signature.
+func TestMultiFault(t *testing.T) {
+	params := parameters.MakeSphincsPlusSHA256128fRobust(false)
+
+	message := make([]byte, params.N)
+	rand.Read(message)
+
+	sk, pk := Spx_keygen(params)
+	faultModel := &MultiFault{
+		MultiFault: &hypertree.MultiFault{Faults: []hypertree.FaultModel{
+			&hypertree.BitFlipFault{Layer: 2, Magnitude: hypertree.FixedMagnitude(8)},
+			&hypertree.BitFlipFault{Layer: 5, Magnitude: hypertree.FixedMagnitude(8)},
+		}},
+		Fors: &ForsFault{Target: TreePKAUTHTarget, Bits: 1},
+	}
+	signature, report := Spx_sign_fault_report(params, message, sk, faultModel, nil)
+	if len(report.ForsTrees) != 1 || len(report.Layers) != 2 || report.Layer(2) == nil || report.Layer(5) == nil {
+		t.Errorf("Expected faults in FORS and layers 2 and 5")
+	}
+	if !Spx_verify(params, message, signature, pk) {
+		t.Errorf("Verification failed with faults in several layers")
+	}
+}
+
 // ------- BENCHMARKING -------
 func BenchmarkSphincsPlus(b *testing.B) {
 	cases := []struct {
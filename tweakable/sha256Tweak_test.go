@@ -2,6 +2,7 @@ package tweakable
 
 import (
 	"bytes"
+	"encoding/binary"
 	"encoding/hex"
 	"fmt"
 	"testing"
@@ -83,3 +84,58 @@ func TestCompressADRSType1(t *testing.T) {
 	}
 
 }
+
+// Tests that AddressFaultTweak hashes with the corrupted address without changing the caller's ADRS.
+func TestAddressFaultTweak(t *testing.T) {
+	tweak := &Sha256Tweak{Variant: Robust, MessageDigestLength: 30, N: 16}
+	PKseed := make([]byte, 16)
+	tmp := make([]byte, 16)
+	adrs := new(address.ADRS)
+	adrs.SetChainAddress(3)
+
+	faulty := &AddressFaultTweak{Tweak: tweak, Corrupt: func(adrs *address.ADRS) { adrs.SetChainAddress(4) }}
+	result := faulty.F(PKseed, adrs, tmp)
+	if binary.BigEndian.Uint32(adrs.ChainAddress[:]) != 3 {
+		t.Errorf("AddressFaultTweak changed the caller's address")
+	}
+
+	expectedAdrs := new(address.ADRS)
+	expectedAdrs.SetChainAddress(4)
+	if !bytes.Equal(result, tweak.F(PKseed, expectedAdrs, tmp)) {
+		t.Errorf("AddressFaultTweak didn't hash with the corrupted address")
+	}
+	if bytes.Equal(result, tweak.F(PKseed, adrs, tmp)) {
+		t.Errorf("AddressFaultTweak hashed with the original address")
+	}
+}
+
+// Tests that CallFaultTweak counts every call and only corrupts the chosen call selected by its filter.
+func TestCallFaultTweak(t *testing.T) {
+	tweak := &Sha256Tweak{Variant: Robust, MessageDigestLength: 30, N: 16}
+	PKseed := make([]byte, 16)
+	tmp := make([]byte, 16)
+	adrs := new(address.ADRS)
+
+	faulty := &CallFaultTweak{
+		Tweak:   tweak,
+		Filter:  func(function string, adrs *address.ADRS) bool { return function == FCall },
+		Call:    1,
+		Corrupt: func(function string, adrs *address.ADRS, output []byte) { output[0] ^= 1 },
+	}
+	results := [][]byte{
+		faulty.H(PKseed, adrs, append(tmp, tmp...)),
+		faulty.F(PKseed, adrs, tmp),
+		faulty.F(PKseed, adrs, tmp),
+		faulty.F(PKseed, adrs, tmp),
+	}
+	if faulty.Total() != 4 || faulty.Calls[FCall] != 3 || faulty.Calls[HCall] != 1 || faulty.Selected != 3 {
+		t.Errorf("CallFaultTweak counted the calls wrong: %v", faulty.Calls)
+	}
+	correctF := tweak.F(PKseed, adrs, tmp)
+	if !bytes.Equal(results[0], tweak.H(PKseed, adrs, append(tmp, tmp...))) || !bytes.Equal(results[1], correctF) || !bytes.Equal(results[3], correctF) {
+		t.Errorf("CallFaultTweak corrupted a call it shouldn't have")
+	}
+	if bytes.Equal(results[2], correctF) {
+		t.Errorf("CallFaultTweak didn't corrupt the chosen call")
+	}
+}
@@ -0,0 +1,119 @@
+package tweakable
+
+import "github.com/kasperdi/SPHINCSPLUS-golang/address"
+
+// AddressFaultTweak wraps a tweakable hash function, letting Corrupt change the address of every call which takes one.
+// Corrupt is given a copy of the address, so the ADRS of the caller is never changed.
+type AddressFaultTweak struct {
+	Tweak   TweakableHashFunction
+	Corrupt func(adrs *address.ADRS)
+}
+
+func (h *AddressFaultTweak) Hmsg(R []byte, PKseed []byte, PKroot []byte, M []byte) []byte {
+	return h.Tweak.Hmsg(R, PKseed, PKroot, M)
+}
+
+func (h *AddressFaultTweak) PRF(SEED []byte, adrs *address.ADRS) []byte {
+	return h.Tweak.PRF(SEED, h.corrupt(adrs))
+}
+
+func (h *AddressFaultTweak) PRFmsg(SKprf []byte, OptRand []byte, M []byte) []byte {
+	return h.Tweak.PRFmsg(SKprf, OptRand, M)
+}
+
+func (h *AddressFaultTweak) F(PKseed []byte, adrs *address.ADRS, tmp []byte) []byte {
+	return h.Tweak.F(PKseed, h.corrupt(adrs), tmp)
+}
+
+func (h *AddressFaultTweak) H(PKseed []byte, adrs *address.ADRS, tmp []byte) []byte {
+	return h.Tweak.H(PKseed, h.corrupt(adrs), tmp)
+}
+
+func (h *AddressFaultTweak) T_l(PKseed []byte, adrs *address.ADRS, tmp []byte) []byte {
+	return h.Tweak.T_l(PKseed, h.corrupt(adrs), tmp)
+}
+
+func (h *AddressFaultTweak) corrupt(adrs *address.ADRS) *address.ADRS {
+	faulty := adrs.Copy()
+	h.Corrupt(faulty)
+	return faulty
+}
+
+// names of the functions counted by CallFaultTweak
+const (
+	HmsgCall   = "Hmsg"
+	PRFCall    = "PRF"
+	PRFmsgCall = "PRFmsg"
+	FCall      = "F"
+	HCall      = "H"
+	T_lCall    = "T_l"
+)
+
+// CallFaultTweak wraps a tweakable hash function, counting every call and corrupting the output of a chosen call, so a
+// glitch can be injected at a precise point of the signing timeline.
+type CallFaultTweak struct {
+	Tweak TweakableHashFunction
+	// Filter selects the calls which can be corrupted, given the name of the function and a copy of its address (nil
+	// for Hmsg and PRFmsg). A nil Filter selects every call.
+	Filter func(function string, adrs *address.ADRS) bool
+	// Call is the selected call to corrupt, counting from 0. A negative Call corrupts every selected call.
+	Call int
+	// Corrupt changes the output of a corrupted call in place. A nil Corrupt only counts the calls.
+	Corrupt func(function string, adrs *address.ADRS, output []byte)
+	// Calls counts the calls made to each function, and Selected those selected by Filter
+	Calls    map[string]int
+	Selected int
+}
+
+func (h *CallFaultTweak) Hmsg(R []byte, PKseed []byte, PKroot []byte, M []byte) []byte {
+	return h.fault(HmsgCall, nil, h.Tweak.Hmsg(R, PKseed, PKroot, M))
+}
+
+func (h *CallFaultTweak) PRF(SEED []byte, adrs *address.ADRS) []byte {
+	return h.fault(PRFCall, adrs, h.Tweak.PRF(SEED, adrs))
+}
+
+func (h *CallFaultTweak) PRFmsg(SKprf []byte, OptRand []byte, M []byte) []byte {
+	return h.fault(PRFmsgCall, nil, h.Tweak.PRFmsg(SKprf, OptRand, M))
+}
+
+func (h *CallFaultTweak) F(PKseed []byte, adrs *address.ADRS, tmp []byte) []byte {
+	return h.fault(FCall, adrs, h.Tweak.F(PKseed, adrs, tmp))
+}
+
+func (h *CallFaultTweak) H(PKseed []byte, adrs *address.ADRS, tmp []byte) []byte {
+	return h.fault(HCall, adrs, h.Tweak.H(PKseed, adrs, tmp))
+}
+
+func (h *CallFaultTweak) T_l(PKseed []byte, adrs *address.ADRS, tmp []byte) []byte {
+	return h.fault(T_lCall, adrs, h.Tweak.T_l(PKseed, adrs, tmp))
+}
+
+// Total returns the number of calls made to every function
+func (h *CallFaultTweak) Total() int {
+	total := 0
+	for _, calls := range h.Calls {
+		total += calls
+	}
+	return total
+}
+
+func (h *CallFaultTweak) fault(function string, adrs *address.ADRS, output []byte) []byte {
+	if h.Calls == nil {
+		h.Calls = make(map[string]int)
+	}
+	h.Calls[function] += 1
+
+	if adrs != nil {
+		adrs = adrs.Copy()
+	}
+	if h.Filter != nil && !h.Filter(function, adrs) {
+		return output
+	}
+	call := h.Selected
+	h.Selected += 1
+	if h.Corrupt != nil && (h.Call < 0 || call == h.Call) {
+		h.Corrupt(function, adrs, output)
+	}
+	return output
+}
@@ -0,0 +1,72 @@
+package util
+
+import (
+	"crypto/rand"
+	mathrand "math/rand"
+
+	"golang.org/x/crypto/sha3"
+)
+
+// DRBG is a deterministic random bit generator based on SHAKE256. The same seed always produces the same
+// stream of bytes, so any run using it as its source of randomness can be replayed. DRBG implements both
+// io.Reader and math/rand.Source64.
+type DRBG struct {
+	shake sha3.ShakeHash
+}
+
+func NewDRBG(seed []byte) *DRBG {
+	shake := sha3.NewShake256()
+	shake.Write(seed)
+	return &DRBG{shake}
+}
+
+// NewSeed returns a fresh 32 byte seed read from crypto/rand
+func NewSeed() []byte {
+	seed := make([]byte, 32)
+	if _, err := rand.Read(seed); err != nil {
+		panic(err)
+	}
+	return seed
+}
+
+// Read fills p with the next len(p) bytes of the stream, it never returns an error
+func (d *DRBG) Read(p []byte) (int, error) {
+	return d.shake.Read(p)
+}
+
+// Bytes returns the next n bytes of the stream
+func (d *DRBG) Bytes(n int) []byte {
+	out := make([]byte, n)
+	d.Read(out)
+	return out
+}
+
+func (d *DRBG) Uint64() uint64 {
+	return BytesToUint64(d.Bytes(8))
+}
+
+func (d *DRBG) Int63() int64 {
+	return int64(d.Uint64() >> 1)
+}
+
+// Seed restarts the stream from an integer seed
+func (d *DRBG) Seed(seed int64) {
+	*d = *NewDRBG(ToByte(uint64(seed), 8))
+}
+
+// Intn returns a random int in [0, n) from r, or from the global math/rand source if r is nil, so fault models can
+// leave their source unset when runs needn't be replayed
+func Intn(r *mathrand.Rand, n int) int {
+	if r == nil {
+		return mathrand.Intn(n)
+	}
+	return r.Intn(n)
+}
+
+// Float64 returns a random float64 in [0, 1) from r, or from the global math/rand source if r is nil, as Intn
+func Float64(r *mathrand.Rand) float64 {
+	if r == nil {
+		return mathrand.Float64()
+	}
+	return r.Float64()
+}
@@ -59,3 +59,16 @@ func Base_w(X []byte, w int, out_len int) []int {
 	}
 	return basew
 }
+
+// FlippedBits returns the positions of the bits that differ between a and b, with bit i of byte j at 8*j + i
+func FlippedBits(a, b []byte) []int {
+	flipped := make([]int, 0)
+	for i := range a {
+		for bit := 0; bit < 8; bit++ {
+			if (a[i]^b[i])&(1<<bit) != 0 {
+				flipped = append(flipped, 8*i+bit)
+			}
+		}
+	}
+	return flipped
+}
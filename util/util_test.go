@@ -1,6 +1,7 @@
 package util
 
 import (
+	"bytes"
 	"testing"
 )
 
@@ -38,3 +39,27 @@ func TestBase_w(t *testing.T) {
 		}
 	}
 }
+
+// Test that a DRBG produces the same stream for the same seed and a different stream otherwise
+func TestDRBG(t *testing.T) {
+	a := NewDRBG([]byte("seed"))
+	b := NewDRBG([]byte("seed"))
+	c := NewDRBG([]byte("other seed"))
+
+	streamA := a.Bytes(64)
+	if !bytes.Equal(streamA, b.Bytes(64)) {
+		t.Errorf("DRBGs with the same seed produced different output")
+	}
+	if bytes.Equal(streamA, c.Bytes(64)) {
+		t.Errorf("DRBGs with different seeds produced the same output")
+	}
+	if a.Uint64() != b.Uint64() {
+		t.Errorf("DRBGs with the same seed produced different output after reading")
+	}
+
+	a.Seed(42)
+	b.Seed(42)
+	if a.Int63() != b.Int63() {
+		t.Errorf("DRBGs reseeded with the same value produced different output")
+	}
+}
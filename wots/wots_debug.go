@@ -39,9 +39,7 @@ func Wots_sign_debug(params *parameters.Parameters, message []byte, SKseed []byt
 		copy(sig[i*params.N:], chain(params, sk, 0, msg[i], PKseed, adrs))
 	}
 
-	if adrs.LayerAddress[3] == 16 {
-		fmt.Printf("[Secret] final layer WOTS sk: %x...\n", sks[:256])
-	}
+	fmt.Printf("[Secret] layer %d WOTS sk: %x...\n", adrs.LayerAddress[3], sks[:8*params.N])
 
 	return sig
 }
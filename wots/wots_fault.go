@@ -0,0 +1,64 @@
+package wots
+
+import (
+	"github.com/kasperdi/SPHINCSPLUS-golang/address"
+	"github.com/kasperdi/SPHINCSPLUS-golang/parameters"
+	"github.com/kasperdi/SPHINCSPLUS-golang/util"
+	"math"
+)
+
+// ChainFault is called for every chain computed while signing. It returns the hash address of the first F iteration
+// that is skipped and how many consecutive iterations are skipped, with skipCount 0 computing the chain correctly.
+type ChainFault func(chainIdx int, steps int) (skipFrom int, skipCount int)
+
+// Calculates the value of F iterated s times on X, leaving out the iterations in [skipFrom, skipFrom + skipCount)
+func chain_fault(params *parameters.Parameters, X []byte, startIndex int, steps int, PKseed []byte, adrs *address.ADRS, skipFrom int, skipCount int) []byte {
+	if (startIndex + steps) > (params.W - 1) {
+		return nil
+	}
+
+	tmp := make([]byte, params.N)
+	copy(tmp, X)
+
+	for i := startIndex; i < startIndex+steps; i++ {
+		if i >= skipFrom && i < skipFrom+skipCount {
+			continue
+		}
+		adrs.SetHashAddress(i)
+		copy(tmp, params.Tweak.F(PKseed, adrs, tmp))
+	}
+
+	return tmp
+}
+
+// Signs a message using WOTS+, with chainFault deciding which iterations of each chain are skipped
+func Wots_sign_fault(params *parameters.Parameters, message []byte, SKseed []byte, PKseed []byte, adrs *address.ADRS, chainFault ChainFault) []byte {
+	csum := 0
+
+	// Convert message to base w
+	msg := util.Base_w(message, params.W, params.Len1)
+
+	for i := 0; i < params.Len1; i++ {
+		csum = csum + params.W - 1 - msg[i]
+	}
+
+	// convert csum to base w
+	if int(math.Log2(float64(params.W)))%8 != 0 {
+		csum = csum << (8 - ((params.Len2 * int(math.Log2(float64(params.W)))) % 8))
+	}
+
+	len2_bytes := int(math.Ceil((float64(params.Len2) * math.Log2(float64(params.W))) / 8))
+	msg = append(msg, util.Base_w(util.ToByte(uint64(csum), len2_bytes), params.W, params.Len2)...)
+
+	sig := make([]byte, params.Len*params.N)
+
+	for i := 0; i < params.Len; i++ {
+		adrs.SetChainAddress(i)
+		adrs.SetHashAddress(0)
+		sk := params.Tweak.PRF(SKseed, adrs)
+		skipFrom, skipCount := chainFault(i, msg[i])
+		copy(sig[i*params.N:], chain_fault(params, sk, 0, msg[i], PKseed, adrs, skipFrom, skipCount))
+	}
+
+	return sig
+}
@@ -10,6 +10,7 @@ import (
 
 	"github.com/kasperdi/SPHINCSPLUS-golang/address"
 	"github.com/kasperdi/SPHINCSPLUS-golang/parameters"
+	"github.com/kasperdi/SPHINCSPLUS-golang/util"
 )
 
 func TestChainIndexStepsTooLow(t *testing.T) {
@@ -115,3 +116,47 @@ func testSignAndVerify(t *testing.T, params *parameters.Parameters) {
 	}
 
 }
+
+// Tests that aborting a chain early leaves a value lower down the same hash chain.
+func TestSignFaultAbort(t *testing.T) {
+	params := parameters.MakeSphincsPlusSHA256128fRobust(false)
+	message := make([]byte, params.N)
+	rand.Read(message)
+	SKseed := make([]byte, params.N)
+	rand.Read(SKseed)
+	PKseed := make([]byte, params.N)
+	rand.Read(PKseed)
+	var adrs address.ADRS
+
+	signature := Wots_sign(params, message, SKseed, PKseed, &adrs)
+	unfaulted := Wots_sign_fault(params, message, SKseed, PKseed, &adrs, func(chainIdx int, steps int) (int, int) {
+		return steps, 0
+	})
+	if !bytes.Equal(signature, unfaulted) {
+		t.Fatalf("Signing without skipping any iterations should match Wots_sign")
+	}
+
+	msg := util.Base_w(message, params.W, params.Len1)
+	for i := 0; i < params.Len1; i++ {
+		if msg[i] < 2 {
+			continue
+		}
+		faulty := Wots_sign_fault(params, message, SKseed, PKseed, &adrs, func(chainIdx int, steps int) (int, int) {
+			if chainIdx != i {
+				return steps, 0
+			}
+			return steps - 2, 2
+		})
+		adrs.SetChainAddress(i)
+		value := chain(params, faulty[i*params.N:(i+1)*params.N], msg[i]-2, 2, PKseed, &adrs)
+		if !bytes.Equal(value, signature[i*params.N:(i+1)*params.N]) {
+			t.Errorf("Aborted chain %d was not on the hash chain", i)
+		}
+		for j := 0; j < params.Len; j++ {
+			if j != i && !bytes.Equal(faulty[j*params.N:(j+1)*params.N], signature[j*params.N:(j+1)*params.N]) {
+				t.Errorf("Chain %d was changed when only chain %d was faulted", j, i)
+			}
+		}
+		break
+	}
+}
@@ -0,0 +1,68 @@
+package xmss
+
+import (
+	"github.com/kasperdi/SPHINCSPLUS-golang/address"
+	"github.com/kasperdi/SPHINCSPLUS-golang/parameters"
+	"github.com/kasperdi/SPHINCSPLUS-golang/wots"
+	"math"
+)
+
+// Xmss_sign_fault signs M as in Xmss_sign, with chainFault skipping iterations of the WOTS chains
+func Xmss_sign_fault(params *parameters.Parameters, M []byte, SKseed []byte, idx int, PKseed []byte, adrs *address.ADRS, chainFault wots.ChainFault) *XMSSSignature {
+	AUTH := make([]byte, params.Hprime*params.N)
+	for i := 0; i < params.Hprime; i++ {
+		k := int(math.Floor(float64(idx)/math.Pow(2, float64(i)))) ^ 1
+		copy(AUTH[i*params.N:], treehash(params, SKseed, k*int(math.Pow(2, float64(i))), i, PKseed, adrs))
+	}
+
+	adrs.SetType(address.WOTS_HASH)
+	adrs.SetKeyPairAddress(idx)
+	sig := wots.Wots_sign_fault(params, M, SKseed, PKseed, adrs, chainFault)
+
+	return &XMSSSignature{sig, AUTH}
+}
+
+// NodeFault is called for every node computed on the path from the WOTS leaf to the root, with height 0 being the
+// compressed WOTS pk and height Hprime the root. It may mutate node in place.
+type NodeFault func(height int, node []byte)
+
+// Xmss_pkFromSig_fault computes the root as in Xmss_pkFromSig, letting nodeFault corrupt the nodes on the way
+func Xmss_pkFromSig_fault(params *parameters.Parameters, idx int, SIG_XMSS *XMSSSignature, M []byte, PKseed []byte, adrs *address.ADRS, nodeFault NodeFault) []byte {
+	// compute WOTS+ pk from WOTS+ sig
+	adrs.SetType(address.WOTS_HASH)
+	adrs.SetKeyPairAddress(idx)
+	sig := SIG_XMSS.GetWOTSSig()
+	AUTH := SIG_XMSS.GetXMSSAUTH()
+
+	node0 := wots.Wots_pkFromSig(params, sig, M, PKseed, adrs)
+	nodeFault(0, node0)
+
+	var node1 []byte
+
+	// compute root from WOTS+ pk and AUTH
+	adrs.SetType(address.TREE)
+	adrs.SetTreeIndex(idx)
+	for k := 0; k < params.Hprime; k++ {
+		adrs.SetTreeHeight(k + 1)
+		if int(math.Floor(float64(idx)/math.Pow(2, float64(k))))%2 == 0 {
+			adrs.SetTreeIndex(adrs.GetTreeIndex() / 2)
+
+			bytesToHash := make([]byte, params.N+len(node0))
+			copy(bytesToHash, node0)
+			copy(bytesToHash[params.N:], AUTH[k*params.N:(k+1)*params.N])
+
+			node1 = params.Tweak.H(PKseed, adrs, bytesToHash)
+		} else {
+			adrs.SetTreeIndex((adrs.GetTreeIndex() - 1) / 2)
+
+			bytesToHash := make([]byte, params.N+len(node0))
+			copy(bytesToHash, AUTH[k*params.N:(k+1)*params.N])
+			copy(bytesToHash[params.N:], node0)
+
+			node1 = params.Tweak.H(PKseed, adrs, bytesToHash)
+		}
+		node0 = node1
+		nodeFault(k+1, node0)
+	}
+	return node0
+}
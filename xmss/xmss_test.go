@@ -101,3 +101,33 @@ func TestSignVerifyUnevenIdx(t *testing.T) {
 		t.Errorf("Verification of signed message failed, but was expected to succeed!")
 	}
 }
+
+// Tests that only the nodes from the faulted height upwards are changed.
+func TestPkFromSigFault(t *testing.T) {
+	params := parameters.MakeSphincsPlusSHA256128fRobust(false)
+	message := make([]byte, params.N)
+	SKseed := make([]byte, params.N)
+	PKseed := make([]byte, params.N)
+	var adrs address.ADRS
+
+	PK := Xmss_PKgen(params, SKseed, PKseed, &adrs)
+	signature := Xmss_sign(params, message, SKseed, 5, PKseed, &adrs)
+	heights := make([]int, 0)
+	pkFromSig := Xmss_pkFromSig_fault(params, 5, signature, message, PKseed, &adrs, func(height int, node []byte) {
+		heights = append(heights, height)
+	})
+	if !bytes.Equal(pkFromSig, PK) || len(heights) != params.Hprime+1 {
+		t.Errorf("Expected a node fault doing nothing to be called for every height and not change the root")
+	}
+
+	for height := 0; height <= params.Hprime; height++ {
+		pkFromSig = Xmss_pkFromSig_fault(params, 5, signature, message, PKseed, &adrs, func(h int, node []byte) {
+			if h == height {
+				node[0] ^= 1
+			}
+		})
+		if bytes.Equal(pkFromSig, PK) {
+			t.Errorf("Faulting the node at height %d didn't change the root", height)
+		}
+	}
+}